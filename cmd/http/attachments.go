@@ -0,0 +1,325 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robihdy/passman/internal/data"
+	"github.com/robihdy/passman/internal/validator"
+)
+
+// multipartOverhead is allowed on top of the attachment itself for the
+// multipart boundaries and part headers of an upload.
+const multipartOverhead = 64 * 1024
+
+// isBodyTooLarge reports whether err came from the request body going past
+// its http.MaxBytesReader limit, possibly wrapped by the multipart reader.
+func isBodyTooLarge(err error) bool {
+	return strings.Contains(err.Error(), "http: request body too large")
+}
+
+func (app *application) listAttachmentsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	login, err := app.models.Logins.Get(id, user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !app.contextGetView(r).includes(login) {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	attachments, err := app.models.Attachments.GetAllForLogin(login.ID, user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"attachments": attachments}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// extendDeadlines gives the attachment transfer of the current request up to
+// -attachment-timeout to complete, rather than the server's timeouts, which
+// are sized for JSON requests.
+func (app *application) extendDeadlines(w http.ResponseWriter) error {
+	rc := http.NewResponseController(w)
+	deadline := time.Now().Add(app.config.attachments.timeout)
+
+	err := rc.SetReadDeadline(deadline)
+	if err != nil {
+		return err
+	}
+
+	return rc.SetWriteDeadline(deadline)
+}
+
+// createAttachmentHandler streams the "file" part of a multipart/form-data
+// upload into the blob store. The body is read as it arrives rather than
+// through readJSON, so attachments can be far larger than a JSON body.
+func (app *application) createAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	view := app.contextGetView(r)
+
+	login, err := app.models.Logins.Get(id, user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !view.includes(login) {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Attachments are encrypted by the server, which would defeat the point
+	// of a zero-knowledge login.
+	if login.Mode == data.ModeZeroKnowledge {
+		app.failedValidationResponse(w, r, map[string]string{"mode": "attachments are not supported for zero_knowledge logins"})
+		return
+	}
+
+	err = app.extendDeadlines(w)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, app.config.attachments.maxSize+multipartOverhead)
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		app.badRequestResponse(w, r, errors.New("body must be multipart/form-data"))
+		return
+	}
+
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			switch {
+			case errors.Is(err, io.EOF):
+				app.badRequestResponse(w, r, errors.New("body must contain a file part"))
+			case isBodyTooLarge(err):
+				app.attachmentTooLargeResponse(w, r)
+			default:
+				app.badRequestResponse(w, r, err)
+			}
+			return
+		}
+
+		if part.FormName() != "file" {
+			continue
+		}
+
+		attachment := &data.Attachment{
+			LoginID:     login.ID,
+			Name:        part.FileName(),
+			ContentType: part.Header.Get("Content-Type"),
+		}
+
+		if attachment.ContentType == "" {
+			attachment.ContentType = "application/octet-stream"
+		}
+
+		v := validator.New()
+
+		if data.ValidateAttachment(v, attachment); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		err = app.models.Attachments.Insert(attachment, part, user)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrAttachmentTooLarge), isBodyTooLarge(err):
+				app.attachmentTooLargeResponse(w, r)
+			case errors.Is(err, data.ErrStorageQuota):
+				app.storageQuotaExceededResponse(w, r)
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		headers := make(http.Header)
+		headers.Set("Location", fmt.Sprintf("%s/%d/attachments/%d", view.path, login.ID, attachment.ID))
+
+		err = app.writeJSON(w, http.StatusCreated, envelope{"attachment": attachment}, headers)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+}
+
+// showAttachmentHandler streams the decrypted contents of an attachment.
+func (app *application) showAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	attachmentID, err := app.readAttachmentIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	login, err := app.models.Logins.Get(id, user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !app.contextGetView(r).includes(login) {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	attachment, err := app.models.Attachments.Get(attachmentID, login.ID, user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.extendDeadlines(w)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	contents, err := app.models.Attachments.Open(attachment, user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	defer contents.Close()
+
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Name})
+	if disposition == "" {
+		disposition = "attachment"
+	}
+
+	// The contents were uploaded by the user and must never be rendered as
+	// part of the API's origin.
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	w.Header().Set("Content-Disposition", disposition)
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	// Once the first chunk is written the status can no longer change, so a
+	// failure part way through can only be logged. The client sees a short
+	// body.
+	_, err = io.Copy(w, contents)
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+func (app *application) deleteAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	attachmentID, err := app.readAttachmentIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	login, err := app.models.Logins.Get(id, user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !app.contextGetView(r).includes(login) {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	attachment, err := app.models.Attachments.Get(attachmentID, login.ID, user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Attachments.Delete(attachment, user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "attachment successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/robihdy/passman/internal/data"
+	"github.com/robihdy/passman/internal/validator"
+)
+
+const (
+	batchCreate = "create"
+	batchUpdate = "update"
+	batchDelete = "delete"
+)
+
+// batchOperation is one operation of a batch request. Login holds a create
+// or update body, decoded once the kind of operation is known. Version, if
+// given, must match the login's current version, like an If-Match header.
+type batchOperation struct {
+	Op      string          `json:"op"`
+	ID      int64           `json:"id"`
+	Version *int32          `json:"version"`
+	Login   json.RawMessage `json:"login"`
+
+	create *createLoginInput
+	update *updateLoginInput
+}
+
+// batchResult reports the outcome of one operation with the status code and
+// error its own request would have had.
+type batchResult struct {
+	Op      string      `json:"op"`
+	Status  int         `json:"status"`
+	ID      int64       `json:"id,omitempty"`
+	Version int32       `json:"version,omitempty"`
+	Error   interface{} `json:"error,omitempty"`
+}
+
+// batchValidationError carries the validation errors of an operation out of
+// its step.
+type batchValidationError map[string]string
+
+func (e batchValidationError) Error() string {
+	return "failed validation"
+}
+
+// errBatchPrecondition is returned by an operation whose version doesn't
+// match the login's current version.
+var errBatchPrecondition = errors.New("version does not match")
+
+// decodeBatchLogin decodes the login of an operation as strictly as readJSON
+// decodes a request body.
+func decodeBatchLogin(raw json.RawMessage, dst interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+
+	return dec.Decode(dst)
+}
+
+// batchLoginsHandler creates, updates and deletes many logins in a single
+// transaction. By default the batch is all or nothing and a 422 response
+// means none of it was applied. With "atomic": false every operation that
+// succeeds is kept. Either way the response holds the result of each
+// operation, in order.
+func (app *application) batchLoginsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Atomic     *bool            `json:"atomic"`
+		Operations []batchOperation `json:"operations"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	atomic := input.Atomic == nil || *input.Atomic
+
+	v := validator.New()
+
+	v.Check(len(input.Operations) > 0, "operations", "must contain at least one operation")
+	v.Check(len(input.Operations) <= app.config.limits.maxBatch, "operations", fmt.Sprintf("must not contain more than %d operations", app.config.limits.maxBatch))
+
+	creates := 0
+
+	for i := range input.Operations {
+		op := &input.Operations[i]
+		key := fmt.Sprintf("operations[%d]", i)
+
+		switch op.Op {
+		case batchCreate:
+			creates++
+			op.create = &createLoginInput{}
+			v.Check(op.ID == 0, key+".id", "must not be provided for create")
+			v.Check(op.Version == nil, key+".version", "must not be provided for create")
+			v.Check(len(op.Login) > 0, key+".login", "must be provided")
+		case batchUpdate:
+			op.update = &updateLoginInput{}
+			v.Check(op.ID > 0, key+".id", "must be provided")
+			v.Check(len(op.Login) > 0, key+".login", "must be provided")
+		case batchDelete:
+			v.Check(op.ID > 0, key+".id", "must be provided")
+			v.Check(len(op.Login) == 0, key+".login", "must not be provided for delete")
+		default:
+			v.AddError(key+".op", "must be one of create, update, delete")
+		}
+
+		if len(op.Login) == 0 {
+			continue
+		}
+
+		var dst interface{}
+
+		switch {
+		case op.create != nil:
+			dst = op.create
+		case op.update != nil:
+			dst = op.update
+		default:
+			continue
+		}
+
+		if err := decodeBatchLogin(op.Login, dst); err != nil {
+			v.AddError(key+".login", err.Error())
+		}
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	results := make([]batchResult, len(input.Operations))
+	steps := make([]data.BatchStep, len(input.Operations))
+
+	for i := range input.Operations {
+		op := &input.Operations[i]
+		result := &results[i]
+
+		result.Op = op.Op
+		result.ID = op.ID
+
+		steps[i] = func(ctx context.Context, tx *sql.Tx) error {
+			return app.runBatchOperation(ctx, tx, r, op, result)
+		}
+	}
+
+	// The quota is checked for the batch as a whole, and inside its
+	// transaction, so concurrent requests can't take the user past it.
+	checkQuota := func(ctx context.Context, tx *sql.Tx) error {
+		return app.models.Logins.CheckQuotaTx(ctx, tx, user.ID, creates, app.config.limits.maxLogins)
+	}
+
+	errs, committed, err := app.models.Logins.RunBatch(atomic, checkQuota, steps)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrLoginQuota):
+			app.quotaExceededResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+
+		results[i].Version = 0
+
+		var validationErrors batchValidationError
+
+		switch {
+		case errors.As(err, &validationErrors):
+			results[i].Status = http.StatusUnprocessableEntity
+			results[i].Error = map[string]string(validationErrors)
+		case errors.Is(err, data.ErrRecordNotFound):
+			results[i].Status = http.StatusNotFound
+			results[i].Error = "the requested resource could not be found"
+		case errors.Is(err, errBatchPrecondition):
+			results[i].Status = http.StatusPreconditionFailed
+			results[i].Error = "the record has been modified since you last retrieved it"
+		case errors.Is(err, data.ErrEditConflict):
+			results[i].Status = http.StatusConflict
+			results[i].Error = "unable to update the record due to an edit conflict, please try again"
+		case errors.Is(err, data.ErrBatchRolledBack):
+			results[i].Status = http.StatusFailedDependency
+			results[i].Error = err.Error()
+		default:
+			app.logError(r, err)
+			results[i].Status = http.StatusInternalServerError
+			results[i].Error = "the server encountered a problem and could not process your request"
+		}
+
+		// A create that never happened has no ID to report.
+		if results[i].Op == batchCreate {
+			results[i].ID = 0
+		}
+	}
+
+	status := http.StatusOK
+	if !committed {
+		status = http.StatusUnprocessableEntity
+	}
+
+	err = app.writeJSON(w, status, envelope{"results": results}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// runBatchOperation carries out op inside the batch's transaction, checking
+// it exactly as its own request would be, and records its success in result.
+func (app *application) runBatchOperation(ctx context.Context, tx *sql.Tx, r *http.Request, op *batchOperation, result *batchResult) error {
+	user := app.contextGetUser(r)
+	view := app.contextGetView(r)
+
+	v := validator.New()
+
+	if op.Op == batchCreate {
+		login, err := op.create.login(v, view)
+		if err != nil {
+			return err
+		}
+
+		validateNewLogin(v, view, op.create, login)
+
+		err = app.checkFolderTx(ctx, tx, v, login, user)
+		if err != nil {
+			return err
+		}
+
+		if !v.Valid() {
+			return batchValidationError(v.Errors)
+		}
+
+		err = app.models.Logins.InsertTx(ctx, tx, login, user)
+		if err != nil {
+			return err
+		}
+
+		result.Status = http.StatusCreated
+		result.ID = login.ID
+		result.Version = login.Version
+
+		return nil
+	}
+
+	login, err := app.models.Logins.GetTx(ctx, tx, op.ID, user)
+	if err != nil {
+		return err
+	}
+
+	if !view.includes(login) {
+		return data.ErrRecordNotFound
+	}
+
+	if op.Version != nil && *op.Version != login.Version {
+		return errBatchPrecondition
+	}
+
+	if op.Op == batchDelete {
+		err = app.models.Logins.DeleteTx(ctx, tx, login.ID, user.ID)
+		if err != nil {
+			return err
+		}
+
+		result.Status = http.StatusOK
+
+		return nil
+	}
+
+	err = op.update.apply(v, login)
+	if err != nil {
+		return err
+	}
+
+	data.ValidateLogin(v, login)
+
+	err = app.checkFolderTx(ctx, tx, v, login, user)
+	if err != nil {
+		return err
+	}
+
+	if !v.Valid() {
+		return batchValidationError(v.Errors)
+	}
+
+	err = app.models.Logins.UpdateTx(ctx, tx, login, user)
+	if err != nil {
+		return err
+	}
+
+	result.Status = http.StatusOK
+	result.Version = login.Version
+
+	return nil
+}
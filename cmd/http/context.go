@@ -24,3 +24,19 @@ func (app *application) contextGetUser(r *http.Request) *data.User {
 
 	return user
 }
+
+const viewContextKey = contextKey("view")
+
+func (app *application) contextSetView(r *http.Request, view itemView) *http.Request {
+	ctx := context.WithValue(r.Context(), viewContextKey, view)
+	return r.WithContext(ctx)
+}
+
+func (app *application) contextGetView(r *http.Request) itemView {
+	view, ok := r.Context().Value(viewContextKey).(itemView)
+	if !ok {
+		panic("missing view value in request context")
+	}
+
+	return view
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/robihdy/passman/internal/data"
+	"github.com/robihdy/passman/internal/validator"
+)
+
+// maxMergeLogins is the most logins that can be merged into another at once.
+const maxMergeLogins = 50
+
+// listDuplicatesHandler groups the user's logins that look like the same
+// credential. With same_password=true, only logins whose passwords match as
+// well are grouped.
+func (app *application) listDuplicatesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	samePassword := app.readBool(r.URL.Query(), "same_password", false, v)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	groups, err := app.models.Logins.GetDuplicates(app.contextGetUser(r), samePassword)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	for _, group := range groups {
+		for _, login := range group.Logins {
+			login.MaskHiddenFields()
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"duplicates": groups}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// mergeLoginsHandler merges the logins listed in ids into the one given by
+// target_id, which is kept, and moves the others to the trash.
+func (app *application) mergeLoginsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TargetID int64   `json:"target_id"`
+		IDs      []int64 `json:"ids"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.TargetID > 0, "target_id", "must be provided")
+	v.Check(len(input.IDs) > 0, "ids", "must contain at least one login")
+	v.Check(len(input.IDs) <= maxMergeLogins, "ids", fmt.Sprintf("must not contain more than %d logins", maxMergeLogins))
+
+	for _, id := range input.IDs {
+		v.Check(id != input.TargetID, "ids", "must not contain target_id")
+	}
+
+	ids := make([]string, len(input.IDs))
+	for i, id := range input.IDs {
+		ids[i] = fmt.Sprint(id)
+	}
+	v.Check(validator.Unique(ids), "ids", "must not contain duplicate values")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	view := app.contextGetView(r)
+
+	login, err := app.models.Logins.Get(input.TargetID, user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !view.includes(login) {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// The server can't read zero-knowledge logins, so it can't merge them.
+	v.Check(login.Mode == data.ModeStandard, "target_id", "must not be a zero_knowledge login")
+
+	others := make([]*data.Login, 0, len(input.IDs))
+
+	for _, id := range input.IDs {
+		other, err := app.models.Logins.Get(id, user)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				v.AddError("ids", fmt.Sprintf("login %d must be one of your logins", id))
+				continue
+			default:
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+
+		v.Check(other.Mode == data.ModeStandard, "ids", fmt.Sprintf("login %d must not be a zero_knowledge login", id))
+		v.Check(other.Type == login.Type, "ids", fmt.Sprintf("login %d must be of the same type as the target", id))
+
+		// Attachments are encrypted for the login they belong to, so they
+		// can't move to the target. They would go to the trash with the
+		// merged login and be lost once it is purged.
+		attachments, err := app.models.Attachments.GetAllForLogin(id, user)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		v.Check(len(attachments) == 0, "ids", fmt.Sprintf("login %d has attachments; only the target may have attachments", id))
+
+		others = append(others, other)
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	for _, other := range others {
+		login.Absorb(other)
+	}
+
+	if data.ValidateLogin(v, login); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Logins.Merge(login, others, user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	login.MaskHiddenFields()
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(login.Version))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{view.singular: login}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -47,6 +47,16 @@ func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.
 	app.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
 }
 
+func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Request) {
+	message := "unable to update the record due to an edit conflict, please try again"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the record has been modified since you last retrieved it"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, message)
+}
+
 func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
 	message := "invalid authentication credentials"
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
@@ -73,3 +83,28 @@ func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Requ
 	message := "your user account doesn't have the necessary permissions to access this resource"
 	app.errorResponse(w, r, http.StatusForbidden, message)
 }
+
+func (app *application) sealedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the server is sealed and must be unsealed before it can process your request"
+	app.errorResponse(w, r, http.StatusServiceUnavailable, message)
+}
+
+func (app *application) unsealNotSupportedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the server was not started with the shamir key provider and cannot be sealed or unsealed"
+	app.errorResponse(w, r, http.StatusBadRequest, message)
+}
+
+func (app *application) quotaExceededResponse(w http.ResponseWriter, r *http.Request) {
+	message := "you have reached the maximum number of logins allowed for your account"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *application) attachmentTooLargeResponse(w http.ResponseWriter, r *http.Request) {
+	message := fmt.Sprintf("the attachment must not be larger than %d bytes", app.config.attachments.maxSize)
+	app.errorResponse(w, r, http.StatusRequestEntityTooLarge, message)
+}
+
+func (app *application) storageQuotaExceededResponse(w http.ResponseWriter, r *http.Request) {
+	message := "you have used all the attachment storage allowed for your account"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
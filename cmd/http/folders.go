@@ -0,0 +1,254 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/robihdy/passman/internal/data"
+	"github.com/robihdy/passman/internal/validator"
+	"gopkg.in/guregu/null.v4"
+)
+
+func (app *application) createFolderHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		ParentID null.Int `json:"parent_id"`
+		Name     string   `json:"name"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	folder := &data.Folder{
+		ParentID: input.ParentID,
+		Name:     input.Name,
+	}
+
+	user := app.contextGetUser(r)
+
+	v := validator.New()
+
+	data.ValidateFolder(v, folder)
+
+	err = app.checkParentFolder(v, folder, user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Folders.Insert(folder, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateFolder):
+			v.AddError("name", "a folder with this name already exists here")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/folders/%d", folder.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"folder": folder}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listFoldersHandler(w http.ResponseWriter, r *http.Request) {
+	folders, err := app.models.Folders.GetAllForUser(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"folders": folders}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showFolderHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	folder, err := app.models.Folders.Get(id, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"folder": folder}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateFolderHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	folder, err := app.models.Folders.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		ParentID *int64  `json:"parent_id"`
+		Name     *string `json:"name"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// A parent_id of 0 moves the folder to the top level.
+	if input.ParentID != nil {
+		folder.ParentID = null.NewInt(*input.ParentID, *input.ParentID != 0)
+	}
+	if input.Name != nil {
+		folder.Name = *input.Name
+	}
+
+	v := validator.New()
+
+	data.ValidateFolder(v, folder)
+
+	err = app.checkParentFolder(v, folder, user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Folders.Update(folder, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateFolder):
+			v.AddError("name", "a folder with this name already exists here")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrFolderCycle):
+			v.AddError("parent_id", "must not be the folder itself or one of its subfolders")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"folder": folder}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteFolderHandler deletes a folder. The contents query parameter says
+// what happens to what's inside it: "move" (the default) hands its logins and
+// subfolders to its parent, "trash" moves every login below it to the trash.
+func (app *application) deleteFolderHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+
+	contents := app.readString(r.URL.Query(), "contents", data.FolderContentsMove)
+
+	v.Check(validator.In(contents, data.FolderContentsMove, data.FolderContentsTrash), "contents", "must be move or trash")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	folder, err := app.models.Folders.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Folders.Delete(folder, user.ID, contents)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateFolder):
+			v.AddError("contents", "a subfolder has the same name as a folder in the parent")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "folder successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// checkParentFolder records a validation error if the folder's parent doesn't
+// belong to the user.
+func (app *application) checkParentFolder(v *validator.Validator, folder *data.Folder, user *data.User) error {
+	if !folder.ParentID.Valid {
+		return nil
+	}
+
+	_, err := app.models.Folders.Get(folder.ParentID.Int64, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("parent_id", "must be one of your folders")
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/robihdy/passman/internal/generator"
+	"github.com/robihdy/passman/internal/validator"
+)
+
+// passwordInput is the password of a login as sent by a client: either the
+// password itself or {"generate": {...}} with generator options, so the
+// server picks the password and the client never has to handle it first.
+type passwordInput struct {
+	Value    string
+	Generate *generator.Options
+}
+
+func (p *passwordInput) UnmarshalJSON(b []byte) error {
+	switch {
+	case bytes.Equal(b, []byte("null")):
+		return nil
+	case len(b) > 0 && b[0] == '"':
+		return json.Unmarshal(b, &p.Value)
+	case len(b) == 0 || b[0] != '{':
+		return errors.New(`password must be a string or {"generate": {...}}`)
+	}
+
+	var input struct {
+		Generate *generator.Options `json:"generate"`
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(&input)
+	if err != nil {
+		return err
+	}
+
+	if input.Generate == nil {
+		return errors.New(`password must be a string or {"generate": {...}}`)
+	}
+
+	p.Generate = input.Generate
+	return nil
+}
+
+// resolve returns the password, generating it if the client asked for that.
+// Invalid generator options are recorded in v and give an empty password.
+// Besides being valid, the options must give a password that a login accepts
+// whatever is drawn, so a long passphrase doesn't fail only some of the time.
+func (p *passwordInput) resolve(v *validator.Validator) (string, error) {
+	if p.Generate == nil {
+		return p.Value, nil
+	}
+
+	gv := validator.New()
+
+	if generator.ValidateOptions(gv, p.Generate); gv.Valid() {
+		key := "length"
+		if p.Generate.Type == generator.TypePassphrase {
+			key = "words"
+		}
+
+		shortest, longest := generator.LengthRange(*p.Generate)
+
+		gv.Check(shortest >= 8, key, "must give a password of at least 8 bytes")
+		gv.Check(longest <= 255, key, "must not give a password that can be more than 255 bytes long")
+	}
+
+	if !gv.Valid() {
+		for key, message := range gv.Errors {
+			v.AddError("password.generate."+key, message)
+		}
+		return "", nil
+	}
+
+	return generator.Generate(*p.Generate)
+}
+
+func (app *application) generatePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var input generator.Options
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if generator.ValidateOptions(v, &input); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	password, err := generator.Generate(input)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"password": password}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -6,7 +6,8 @@ import (
 
 func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Request) {
 	env := envelope{
-		"status": "available",
+		"status":      "available",
+		"seal_status": app.sealStatus(),
 		"system_info": map[string]string{
 			"environment": app.config.env,
 			"version":     version,
@@ -9,6 +9,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/robihdy/passman/internal/validator"
@@ -27,6 +28,50 @@ func (app *application) readIDParam(r *http.Request) (int64, error) {
 	return id, nil
 }
 
+func (app *application) readVersionParam(r *http.Request) (int32, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	version, err := strconv.ParseInt(params.ByName("version"), 10, 32)
+	if err != nil || version < 1 {
+		return 0, errors.New("invalid version parameter")
+	}
+
+	return int32(version), nil
+}
+
+func (app *application) readAttachmentIDParam(r *http.Request) (int64, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.ParseInt(params.ByName("attachment_id"), 10, 64)
+	if err != nil || id < 1 {
+		return 0, errors.New("invalid attachment_id parameter")
+	}
+
+	return id, nil
+}
+
+// withActions lets a /v1/<collection>/:id route also serve named actions such
+// as /v1/logins/search. httprouter won't register a static segment alongside
+// a wildcard, so the action name arrives as the :id parameter. If byID is nil
+// anything that isn't an action is not found.
+func (app *application) withActions(byID http.HandlerFunc, actions map[string]http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+
+		if action, ok := actions[params.ByName("id")]; ok {
+			action(w, r)
+			return
+		}
+
+		if byID == nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		byID(w, r)
+	}
+}
+
 func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
 	js, err := json.MarshalIndent(data, "", "\t")
 	if err != nil {
@@ -47,6 +92,30 @@ func (app *application) writeJSON(w http.ResponseWriter, status int, data envelo
 	return nil
 }
 
+// etag returns a strong entity tag for a versioned record.
+func etag(version int32) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// ifMatch reports whether the request's If-Match precondition, if it has one,
+// is satisfied by the given entity tag. Weak tags never match, as required for
+// If-Match.
+func (app *application) ifMatch(r *http.Request, tag string) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return true
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
 	maxBytes := 1_048_576
 	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
@@ -126,3 +195,47 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 
 	return i
 }
+
+// readDuration reads a duration such as "36h" or, as Go has no unit for
+// them, a number of days such as "14d".
+func (app *application) readDuration(qs url.Values, key string, defaultValue time.Duration, v *validator.Validator) time.Duration {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			v.AddError(key, "must be a duration such as 14d or 36h")
+			return defaultValue
+		}
+
+		return time.Duration(days) * 24 * time.Hour
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		v.AddError(key, "must be a duration such as 14d or 36h")
+		return defaultValue
+	}
+
+	return d
+}
+
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+
+	return b
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/robihdy/passman/internal/data"
+	"github.com/robihdy/passman/internal/validator"
+)
+
+// itemView is the part of the vault a set of routes works with. The same
+// handlers serve /v1/items, which sees items of every type, and /v1/logins,
+// which only sees logins.
+type itemView struct {
+	itemType string
+	path     string
+	singular string
+	plural   string
+}
+
+var (
+	loginsView = itemView{itemType: data.TypeLogin, path: "/v1/logins", singular: "login", plural: "logins"}
+	itemsView  = itemView{path: "/v1/items", singular: "item", plural: "items"}
+)
+
+// includes reports whether an item can be seen through the view.
+func (view itemView) includes(login *data.Login) bool {
+	return view.itemType == "" || login.Type == view.itemType
+}
+
+func (app *application) withView(view itemView, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		next(w, app.contextSetView(r, view))
+	}
+}
+
+// readItemType returns the item type a list or search request is limited to:
+// the view's own type, or for views covering every type the optional type
+// query parameter.
+func (app *application) readItemType(r *http.Request, v *validator.Validator) string {
+	view := app.contextGetView(r)
+	if view.itemType != "" {
+		return view.itemType
+	}
+
+	itemType := app.readString(r.URL.Query(), "type", "")
+	v.Check(itemType == "" || validator.In(itemType, data.ItemTypes...), "type", "unknown item type")
+
+	return itemType
+}
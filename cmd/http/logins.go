@@ -1,58 +1,170 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/robihdy/passman/internal/data"
+	"github.com/robihdy/passman/internal/totp"
 	"github.com/robihdy/passman/internal/validator"
 	"gopkg.in/guregu/null.v4"
 )
 
-func (app *application) createLoginHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		Name     string      `json:"name"`
-		Username string      `json:"username"`
-		Password string      `json:"password"`
-		Website  null.String `json:"website"`
-	}
+// createLoginInput is the body of a request to create a login.
+type createLoginInput struct {
+	Mode     string               `json:"mode"`
+	Type     string               `json:"type"`
+	Name     string               `json:"name"`
+	Username string               `json:"username"`
+	Password passwordInput        `json:"password"`
+	Website  null.String          `json:"website"`
+	URIs     []data.URI           `json:"uris"`
+	TOTP     string               `json:"totp"`
+	Notes    string               `json:"notes"`
+	Fields   []data.Field         `json:"fields"`
+	FolderID null.Int             `json:"folder_id"`
+	Tags     []string             `json:"tags"`
+	Favorite bool                 `json:"favorite"`
+	Rotation *data.RotationPolicy `json:"rotation"`
+	Item     *data.SealedItem     `json:"item"`
+	Revision int32                `json:"revision"`
+	data.ItemContent
+}
 
-	err := app.readJSON(w, r, &input)
+// login returns the login the input describes, with defaults for the view
+// it is created in. A password to be generated is generated here, and
+// invalid generator options are recorded in v.
+func (input *createLoginInput) login(v *validator.Validator, view itemView) (*data.Login, error) {
+	password, err := input.Password.resolve(v)
 	if err != nil {
-		app.badRequestResponse(w, r, err)
-		return
+		return nil, err
 	}
 
 	login := &data.Login{
+		Mode:     input.Mode,
+		Type:     input.Type,
 		Name:     input.Name,
 		Username: input.Username,
-		Password: input.Password,
-		Website:  input.Website,
+		Password: password,
+		URIs:     input.URIs,
+		TOTP:     input.TOTP,
+		Notes:    input.Notes,
+		Fields:   input.Fields,
+		FolderID: input.FolderID,
+		Tags:     data.NormalizeTags(input.Tags),
+		Favorite: input.Favorite,
+		Rotation: data.NormalizeRotation(input.Rotation),
+		Item:     input.Item,
+		Revision: input.Revision,
+
+		ItemContent: input.ItemContent,
+	}
+
+	if login.Mode == "" {
+		login.Mode = data.ModeStandard
+	}
+	if login.Type == "" {
+		login.Type = view.itemType
+	}
+	// A website on its own is shorthand for a single URI.
+	if input.URIs == nil {
+		login.SetPrimaryURI(input.Website.String)
+	}
+	login.URIs = data.NormalizeURIs(login.URIs)
+
+	return login, nil
+}
+
+// validateNewLogin checks a login about to be created from input in view,
+// except for its folder.
+func validateNewLogin(v *validator.Validator, view itemView, input *createLoginInput, login *data.Login) {
+	v.Check(view.includes(login), "type", "must be "+view.itemType)
+	v.Check(input.URIs == nil || !input.Website.Valid, "website", "must not be provided together with uris")
+
+	data.ValidateLogin(v, login)
+}
+
+// createLoginHandler creates a login. With check_duplicates=true the
+// response also lists the IDs of the user's logins the new one duplicates,
+// as a warning; the login is created regardless.
+func (app *application) createLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var input createLoginInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
 	}
 
+	view := app.contextGetView(r)
+	user := app.contextGetUser(r)
+
 	v := validator.New()
 
-	if data.ValidateLogin(v, login); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+	checkDuplicates := app.readBool(r.URL.Query(), "check_duplicates", false, v)
+
+	login, err := input.login(v, view)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.models.Logins.Insert(login, app.contextGetUser(r).ID)
+	validateNewLogin(v, view, &input, login)
+
+	err = app.checkFolder(v, login, user)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	env := envelope{view.singular: login}
+
+	if checkDuplicates {
+		duplicates, err := app.models.Logins.FindDuplicates(login, user)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		env["duplicates"] = duplicates
+	}
+
+	err = app.models.Logins.Insert(login, user, app.config.limits.maxLogins)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrLoginQuota):
+			app.quotaExceededResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
 	headers := make(http.Header)
-	headers.Set("Location", fmt.Sprintf("/v1/logins/%d", login.ID))
+	headers.Set("Location", fmt.Sprintf("%s/%d", view.path, login.ID))
+	headers.Set("ETag", etag(login.Version))
 
-	err = app.writeJSON(w, http.StatusCreated, envelope{"login": login}, headers)
+	login.MaskHiddenFields()
+
+	err = app.writeJSON(w, http.StatusCreated, env, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
+// showLoginHandler returns a login. The values of hidden custom fields are
+// only included when the reveal query parameter is true. Returning a login's
+// password counts as a use of it.
 func (app *application) showLoginHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := app.readIDParam(r)
 	if err != nil {
@@ -60,7 +172,16 @@ func (app *application) showLoginHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	login, err := app.models.Logins.Get(id, app.contextGetUser(r).ID)
+	v := validator.New()
+
+	reveal := app.readBool(r.URL.Query(), "reveal", false, v)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	login, err := app.models.Logins.Get(id, app.contextGetUser(r))
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -71,12 +192,120 @@ func (app *application) showLoginHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"login": login}, nil)
+	if !app.contextGetView(r).includes(login) {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// The server can't see the password of a zero-knowledge login, so
+	// fetching one isn't a use of it.
+	if login.Type == data.TypeLogin && login.Mode == data.ModeStandard {
+		app.recordUse(r, login)
+	}
+
+	if !reveal {
+		login.MaskHiddenFields()
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(login.Version))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{app.contextGetView(r).singular: login}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
+// updateLoginInput is the body of a request to update a login. Anything left
+// out keeps its current value.
+type updateLoginInput struct {
+	Name     *string              `json:"name"`
+	Username *string              `json:"username"`
+	Password *passwordInput       `json:"password"`
+	Website  *string              `json:"website"`
+	URIs     []data.URI           `json:"uris"`
+	TOTP     *string              `json:"totp"`
+	Notes    *string              `json:"notes"`
+	Fields   []data.Field         `json:"fields"`
+	FolderID *int64               `json:"folder_id"`
+	Tags     []string             `json:"tags"`
+	Favorite *bool                `json:"favorite"`
+	Rotation *data.RotationPolicy `json:"rotation"`
+	Item     *data.SealedItem     `json:"item"`
+	Revision *int32               `json:"revision"`
+	data.ItemContent
+}
+
+// apply merges the input into login, checking what can only be checked
+// against the login's current state. A password to be generated is generated
+// here.
+func (input *updateLoginInput) apply(v *validator.Validator, login *data.Login) error {
+	if input.Name != nil {
+		login.Name = *input.Name
+	}
+	if input.Username != nil {
+		login.Username = *input.Username
+	}
+	if input.Password != nil {
+		password, err := input.Password.resolve(v)
+		if err != nil {
+			return err
+		}
+		login.Password = password
+	}
+	// URIs are replaced as a whole; a website on its own only replaces the
+	// primary URI.
+	if input.URIs != nil {
+		login.URIs = input.URIs
+	} else if input.Website != nil {
+		login.SetPrimaryURI(*input.Website)
+	}
+	login.URIs = data.NormalizeURIs(login.URIs)
+	if input.TOTP != nil {
+		login.TOTP = *input.TOTP
+	}
+	if input.Notes != nil {
+		login.Notes = *input.Notes
+	}
+	// Fields are replaced as a whole. Hidden fields sent back masked keep
+	// their current values.
+	if input.Fields != nil {
+		data.KeepHiddenValues(v, input.Fields, login.Fields)
+		login.Fields = input.Fields
+	}
+	// A folder_id of 0 moves the login out of its folder.
+	if input.FolderID != nil {
+		login.FolderID = null.NewInt(*input.FolderID, *input.FolderID != 0)
+	}
+	if input.Tags != nil {
+		login.Tags = data.NormalizeTags(input.Tags)
+	}
+	if input.Favorite != nil {
+		login.Favorite = *input.Favorite
+	}
+	// An empty rotation policy removes the login's policy.
+	if input.Rotation != nil {
+		login.Rotation = data.NormalizeRotation(input.Rotation)
+	}
+	if input.Item != nil {
+		login.Item = input.Item
+	}
+	login.ItemContent.Merge(input.ItemContent)
+
+	v.Check(input.URIs == nil || input.Website == nil, "website", "must not be provided together with uris")
+
+	// A zero-knowledge client bumps the revision whenever it reseals the
+	// item, so a stale client can't silently replace a newer one.
+	if input.Revision != nil {
+		v.Check(*input.Revision > login.Revision, "revision", "must be greater than the current revision")
+		login.Revision = *input.Revision
+	} else if input.Item != nil {
+		v.AddError("revision", "must be provided when the item changes")
+	}
+
+	return nil
+}
+
 func (app *application) updateLoginHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := app.readIDParam(r)
 	if err != nil {
@@ -84,7 +313,7 @@ func (app *application) updateLoginHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	login, err := app.models.Logins.Get(id, app.contextGetUser(r).ID)
+	login, err := app.models.Logins.Get(id, app.contextGetUser(r))
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -95,45 +324,62 @@ func (app *application) updateLoginHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	var input struct {
-		Name     *string `json:"name"`
-		Username *string `json:"username"`
-		Password *string `json:"password"`
-		Website  *string `json:"website"`
+	if !app.contextGetView(r).includes(login) {
+		app.notFoundResponse(w, r)
+		return
 	}
 
+	if !app.ifMatch(r, etag(login.Version)) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	var input updateLoginInput
+
 	err = app.readJSON(w, r, &input)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
 
-	if input.Name != nil {
-		login.Name = *input.Name
-	}
-	if input.Username != nil {
-		login.Username = *input.Username
-	}
-	if input.Password != nil {
-		login.Password = *input.Password
+	v := validator.New()
+
+	err = input.apply(v, login)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
 	}
-	if input.Website != nil {
-		login.Website = null.StringFrom(*input.Website)
+
+	data.ValidateLogin(v, login)
+
+	err = app.checkFolder(v, login, app.contextGetUser(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
 	}
 
-	v := validator.New()
-	if data.ValidateLogin(v, login); !v.Valid() {
+	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.models.Logins.Update(login)
+	err = app.models.Logins.Update(login, app.contextGetUser(r))
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"login": login}, nil)
+	login.MaskHiddenFields()
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(login.Version))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{app.contextGetView(r).singular: login}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -146,7 +392,26 @@ func (app *application) deleteLoginHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.models.Logins.Delete(id, app.contextGetUser(r).ID)
+	user := app.contextGetUser(r)
+	view := app.contextGetView(r)
+
+	login, err := app.models.Logins.Get(id, user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !view.includes(login) {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Logins.Delete(login.ID, user.ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -157,7 +422,7 @@ func (app *application) deleteLoginHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "login successfully deleted"}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": view.singular + " successfully moved to the trash"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -165,8 +430,7 @@ func (app *application) deleteLoginHandler(w http.ResponseWriter, r *http.Reques
 
 func (app *application) listLoginsHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Name     string
-		Username string
+		data.LoginQuery
 		data.Filters
 	}
 
@@ -174,25 +438,405 @@ func (app *application) listLoginsHandler(w http.ResponseWriter, r *http.Request
 
 	qs := r.URL.Query()
 
+	input.Type = app.readItemType(r, v)
 	input.Name = app.readString(qs, "name", "")
 	input.Username = app.readString(qs, "username", "")
+	input.FolderID = int64(app.readInt(qs, "folder", 0, v))
+	input.Recursive = app.readBool(qs, "recursive", false, v)
+	input.Tags = data.NormalizeTags(app.readCSV(qs, "tags", []string{}))
+
+	if qs.Get("favorite") != "" {
+		input.Favorite = null.BoolFrom(app.readBool(qs, "favorite", false, v))
+	}
+
+	tagsMatch := app.readString(qs, "tags_match", "all")
+	v.Check(validator.In(tagsMatch, "any", "all"), "tags_match", "must be any or all")
+	input.AllTags = tagsMatch == "all"
+
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
 	input.Filters.Sort = app.readString(qs, "sort", "id")
-	input.Filters.SortSafelist = []string{"id", "name", "username", "website", "-id", "-name", "-username", "-website"}
+	input.Filters.SortSafelist = []string{"id", "name", "username", "website", "last_used", "use_count",
+		"-id", "-name", "-username", "-website", "-last_used", "-use_count"}
 
 	if data.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	logins, err := app.models.Logins.GetByUserID(app.contextGetUser(r).ID)
+	logins, metadata, err := app.models.Logins.GetByUserID(app.contextGetUser(r), input.LoginQuery, input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"logins": logins}, nil)
+	// Listing logins isn't using them, so their passwords are left for
+	// GET /v1/logins/:id, which counts the use.
+	for _, login := range logins {
+		login.MaskPassword()
+		login.MaskHiddenFields()
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{app.contextGetView(r).plural: logins, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// checkFolder records a validation error if the login is being put in a
+// folder that doesn't belong to the user.
+func (app *application) checkFolder(v *validator.Validator, login *data.Login, user *data.User) error {
+	if !login.FolderID.Valid {
+		return nil
+	}
+
+	_, err := app.models.Folders.Get(login.FolderID.Int64, user.ID)
+	return folderError(v, err)
+}
+
+// checkFolderTx is checkFolder as part of the caller's transaction.
+func (app *application) checkFolderTx(ctx context.Context, tx *sql.Tx, v *validator.Validator, login *data.Login, user *data.User) error {
+	if !login.FolderID.Valid {
+		return nil
+	}
+
+	_, err := app.models.Folders.GetTx(ctx, tx, login.FolderID.Int64, user.ID)
+	return folderError(v, err)
+}
+
+// folderError turns a folder that wasn't found into a validation error.
+func folderError(v *validator.Validator, err error) error {
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		v.AddError("folder_id", "must be one of your folders")
+		return nil
+	default:
+		return err
+	}
+}
+
+func (app *application) searchLoginsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Query string
+		Type  string
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Query = app.readString(qs, "q", "")
+	input.Type = app.readItemType(r, v)
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = "rank"
+	input.Filters.SortSafelist = []string{"rank"}
+
+	v.Check(data.PrefixSearchQuery(input.Query) != "", "q", "must contain at least one word to search for")
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	logins, metadata, err := app.models.Logins.Search(app.contextGetUser(r), input.Query, input.Type, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// As with listing, search results don't carry passwords.
+	for _, login := range logins {
+		login.MaskPassword()
+		login.MaskHiddenFields()
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{app.contextGetView(r).plural: logins, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// matchLoginsHandler finds the logins to offer for autofill on a page, best
+// match first. A single match is the login that will be filled, so it counts
+// as a use. Out of several, the client reports the one the user picks with
+// POST /v1/logins/:id/use.
+func (app *application) matchLoginsHandler(w http.ResponseWriter, r *http.Request) {
+	address := app.readString(r.URL.Query(), "url", "")
+
+	v := validator.New()
+
+	if data.ValidateMatchURL(v, address); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	logins, err := app.models.Logins.GetByURL(address, app.contextGetUser(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if len(logins) == 1 {
+		app.recordUse(r, logins[0])
+	}
+
+	for _, login := range logins {
+		login.MaskHiddenFields()
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{app.contextGetView(r).plural: logins}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// recordUse counts a use of a login whose password is being returned. Usage
+// is only bookkeeping, so failing to record it shouldn't keep the login from
+// the user.
+func (app *application) recordUse(r *http.Request, login *data.Login) {
+	err := app.models.Logins.RecordUse(login)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.logError(r, err)
+	}
+}
+
+// useLoginHandler records that a client has autofilled a login, for sorting
+// logins by how recently and how often they are used.
+func (app *application) useLoginHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	login, err := app.models.Logins.Get(id, app.contextGetUser(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !app.contextGetView(r).includes(login) {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Logins.RecordUse(login)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	usage := envelope{"last_used_at": login.LastUsedAt, "use_count": login.UseCount}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"usage": usage}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listLoginRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+
+	reveal := app.readBool(r.URL.Query(), "reveal", false, v)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	login, err := app.models.Logins.Get(id, user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !app.contextGetView(r).includes(login) {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	revisions, err := app.models.Logins.GetRevisions(login, user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !reveal {
+		for _, revision := range revisions {
+			revision.MaskHiddenFields()
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"revisions": revisions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) restoreLoginRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	version, err := app.readVersionParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	login, err := app.models.Logins.Get(id, user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !app.contextGetView(r).includes(login) {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if !app.ifMatch(r, etag(login.Version)) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	revision, err := app.models.Logins.GetRevision(login, version, user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Logins.Restore(login, revision, user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	login.MaskHiddenFields()
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(login.Version))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{app.contextGetView(r).singular: login}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// pruneRevisions deletes revisions that have outlived -revisions-max-age-days,
+// checking every interval until stop is closed. Without a maximum age, or with
+// a zero interval, nothing is pruned.
+func (app *application) pruneRevisions(stop <-chan struct{}) {
+	if app.config.limits.revisionsMaxAge <= 0 || app.config.limits.revisionsPruneInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(app.config.limits.revisionsPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			n, err := app.models.Logins.PruneRevisions()
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+
+			if n > 0 {
+				app.logger.PrintInfo("revisions pruned", map[string]string{
+					"revisions": strconv.FormatInt(n, 10),
+				})
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// showTOTPHandler returns the login's current one-time code and how many
+// seconds it stays valid for.
+func (app *application) showTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	login, err := app.models.Logins.Get(id, app.contextGetUser(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !app.contextGetView(r).includes(login) || login.TOTP == "" {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	key, err := totp.Parse(login.TOTP)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	now := time.Now()
+
+	code := envelope{
+		"code":      key.Code(now),
+		"remaining": key.Remaining(now),
+		"period":    key.Period,
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"totp": code}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -3,14 +3,22 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/hex"
+	"errors"
 	"flag"
+	"fmt"
+	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	_ "github.com/lib/pq"
+	"github.com/robihdy/passman/internal/blob"
 	"github.com/robihdy/passman/internal/data"
+	"github.com/robihdy/passman/internal/encryption"
 	"github.com/robihdy/passman/internal/jsonlog"
+	"github.com/robihdy/passman/internal/notify"
 )
 
 const version = "1.0.0"
@@ -27,12 +35,62 @@ type config struct {
 	cors struct {
 		trustedOrigins []string
 	}
+	limits struct {
+		maxLogins              int
+		maxBatch               int
+		revisionsKeep          int
+		revisionsMaxAge        int
+		revisionsPruneInterval time.Duration
+	}
+	trash struct {
+		retentionDays int
+		purgeInterval time.Duration
+	}
+	attachments struct {
+		backend string
+		dir     string
+		maxSize int64
+		quota   int64
+		timeout time.Duration
+	}
+	rotation struct {
+		checkInterval time.Duration
+	}
+	notifier struct {
+		backend          string
+		webhookURL       string
+		webhookSecretEnv string
+	}
+	encryption struct {
+		provider       string
+		keyID          string
+		keyEnv         string
+		keyFile        string
+		passphraseEnv  string
+		passphraseSalt string
+		transit        struct {
+			addr       string
+			mount      string
+			keyName    string
+			tokenEnv   string
+			wrappedKey string
+		}
+		retiredKeys        string
+		retiredKeysWrapped string
+		unsealThreshold    int
+		unsealCheck        string
+		reencrypt          bool
+		reencryptBatches   int
+	}
 }
 
 type application struct {
-	config config
-	logger *jsonlog.Logger
-	models data.Models
+	config   config
+	logger   *jsonlog.Logger
+	models   data.Models
+	keys     *encryption.KeyRing
+	unsealer *unsealer
+	notifier notify.Notifier
 }
 
 func main() {
@@ -46,14 +104,58 @@ func main() {
 	flag.IntVar(&cfg.db.maxIdleConns, "db_max_idle_conns", 25, "PostgreSQL max idle connections")
 	flag.StringVar(&cfg.db.maxIdleTime, "db_max_idle_time", "15m", "PostgreSQL max connection idle time")
 
+	flag.IntVar(&cfg.limits.maxLogins, "max-logins-per-user", 10000, "Maximum number of logins each user may store")
+	flag.IntVar(&cfg.limits.maxBatch, "max-batch-operations", 500, "Maximum number of operations in a single batch request")
+	flag.IntVar(&cfg.limits.revisionsKeep, "revisions-keep", 50, "Number of earlier revisions kept for each login (0 for no limit)")
+	flag.IntVar(&cfg.limits.revisionsMaxAge, "revisions-max-age-days", 0, "Days earlier revisions of a login are kept for (0 for no limit)")
+	flag.DurationVar(&cfg.limits.revisionsPruneInterval, "revisions-prune-interval", time.Hour, "How often revisions older than -revisions-max-age-days are deleted (0 to disable)")
+
+	flag.IntVar(&cfg.trash.retentionDays, "trash-retention-days", 30, "Days deleted logins stay in the trash before being purged")
+	flag.DurationVar(&cfg.trash.purgeInterval, "trash-purge-interval", time.Hour, "How often the trash is checked for logins to purge (0 to disable)")
+
+	flag.StringVar(&cfg.attachments.backend, "attachments-backend", "local", "Where attachment contents are stored (local)")
+	flag.StringVar(&cfg.attachments.dir, "attachments-dir", "attachments", "Directory attachment contents are stored in (local backend)")
+	flag.Int64Var(&cfg.attachments.maxSize, "attachment-max-size", 25<<20, "Maximum size in bytes of a single attachment")
+	flag.Int64Var(&cfg.attachments.quota, "attachment-quota", 250<<20, "Total size in bytes of the attachments each user may store")
+	flag.DurationVar(&cfg.attachments.timeout, "attachment-timeout", 5*time.Minute, "Longest an attachment upload or download may take")
+
+	flag.DurationVar(&cfg.rotation.checkInterval, "rotation-check-interval", time.Hour, "How often logins are checked for overdue password rotations (0 to disable)")
+
+	flag.StringVar(&cfg.notifier.backend, "notifier", "log", "Where notifications to users are sent (log|webhook|none)")
+	flag.StringVar(&cfg.notifier.webhookURL, "notifier-webhook-url", "", "URL notifications are POSTed to (webhook notifier)")
+	flag.StringVar(&cfg.notifier.webhookSecretEnv, "notifier-webhook-secret-env", "PASSMAN_WEBHOOK_SECRET", "Environment variable holding the secret webhook bodies are signed with (webhook notifier)")
+
 	var trustedOrigins string
 	flag.StringVar(&trustedOrigins, "cors-trusted-origins", "*", "Trusted CORS origins (space separated)")
 	cfg.cors.trustedOrigins = strings.Fields(trustedOrigins)
 
+	flag.StringVar(&cfg.encryption.provider, "encryption-key-provider", "env", "Where the encryption key comes from (env|file|passphrase|transit|shamir)")
+	flag.StringVar(&cfg.encryption.keyID, "encryption-key-id", "default", "ID recorded in ciphertexts sealed with the encryption key")
+	flag.StringVar(&cfg.encryption.keyEnv, "encryption-key-env", "PASSMAN_ENCRYPTION_KEY", "Environment variable holding the hex-encoded 32-byte key (env provider)")
+	flag.StringVar(&cfg.encryption.keyFile, "encryption-key-file", "", "File holding the hex-encoded 32-byte key, mode 0600 or stricter (file provider)")
+	flag.StringVar(&cfg.encryption.passphraseEnv, "encryption-passphrase-env", "PASSMAN_ENCRYPTION_PASSPHRASE", "Environment variable holding the passphrase (passphrase provider)")
+	flag.StringVar(&cfg.encryption.passphraseSalt, "encryption-passphrase-salt", "", "Hex-encoded salt of at least 16 bytes (passphrase provider)")
+	flag.StringVar(&cfg.encryption.transit.addr, "transit-addr", "http://127.0.0.1:8200", "Transit server address (transit provider)")
+	flag.StringVar(&cfg.encryption.transit.mount, "transit-mount", "transit", "Transit engine mount path (transit provider)")
+	flag.StringVar(&cfg.encryption.transit.keyName, "transit-key-name", "passman", "Transit key that wraps the encryption key (transit provider)")
+	flag.StringVar(&cfg.encryption.transit.tokenEnv, "transit-token-env", "VAULT_TOKEN", "Environment variable holding the transit token (transit provider)")
+	flag.StringVar(&cfg.encryption.transit.wrappedKey, "transit-wrapped-key", "", "Encryption key as wrapped by the transit server (transit provider)")
+	flag.StringVar(&cfg.encryption.retiredKeys, "encryption-retired-keys", os.Getenv("PASSMAN_ENCRYPTION_RETIRED_KEYS"), "Retired keys still accepted for decryption (space separated id:hex pairs, not with the shamir provider)")
+	flag.StringVar(&cfg.encryption.retiredKeysWrapped, "encryption-retired-keys-wrapped", os.Getenv("PASSMAN_ENCRYPTION_RETIRED_KEYS_WRAPPED"), "Retired keys wrapped with the master key, as printed by the init command (shamir provider)")
+	flag.IntVar(&cfg.encryption.unsealThreshold, "unseal-threshold", 3, "Number of key shares needed to unseal the server (shamir provider)")
+	flag.StringVar(&cfg.encryption.unsealCheck, "unseal-check", "", "Key check value printed by the init command (shamir provider)")
+	flag.BoolVar(&cfg.encryption.reencrypt, "reencrypt-logins", false, "Re-encrypt every login not sealed with the active encryption key, then exit")
+	flag.IntVar(&cfg.encryption.reencryptBatches, "reencrypt-batch-size", 100, "Number of logins re-encrypted per transaction")
+
 	flag.Parse()
 
 	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
 
+	keys, unsealer, err := openKeyRing(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
 	db, err := openDB(cfg)
 	if err != nil {
 		logger.PrintFatal(err, nil)
@@ -62,10 +164,49 @@ func main() {
 
 	logger.PrintInfo("database connection pool established", nil)
 
+	blobs, err := newBlobStore(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	notifier, err := newNotifier(cfg, logger)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	models := data.NewModels(db, keys, blobs)
+	models.Logins.Revisions = data.RevisionPolicy{
+		Keep:   cfg.limits.revisionsKeep,
+		MaxAge: time.Duration(cfg.limits.revisionsMaxAge) * 24 * time.Hour,
+	}
+	models.Folders.Revisions = models.Logins.Revisions
+	models.Attachments.MaxSize = cfg.attachments.maxSize
+	models.Attachments.Quota = cfg.attachments.quota
+
 	app := &application{
-		config: cfg,
-		logger: logger,
-		models: data.NewModels(db),
+		config:   cfg,
+		logger:   logger,
+		models:   models,
+		keys:     keys,
+		unsealer: unsealer,
+		notifier: notifier,
+	}
+
+	if cfg.encryption.reencrypt {
+		if keys.Sealed() {
+			logger.PrintFatal(errors.New("logins cannot be re-encrypted with the shamir key provider while the server is sealed"), nil)
+		}
+
+		n, err := app.models.Logins.Reencrypt(cfg.encryption.reencryptBatches)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+
+		logger.PrintInfo("logins re-encrypted", map[string]string{
+			"rows":   strconv.Itoa(n),
+			"key_id": keys.ActiveID(),
+		})
+		return
 	}
 
 	// Call app.serve() to start the server.
@@ -100,3 +241,138 @@ func openDB(cfg config) (*sql.DB, error) {
 
 	return db, nil
 }
+
+func newBlobStore(cfg config) (blob.Store, error) {
+	switch cfg.attachments.backend {
+	case "local":
+		return blob.NewLocalStore(cfg.attachments.dir)
+	default:
+		return nil, fmt.Errorf("unknown attachments backend %q", cfg.attachments.backend)
+	}
+}
+
+func newNotifier(cfg config, logger *jsonlog.Logger) (notify.Notifier, error) {
+	switch cfg.notifier.backend {
+	case "log":
+		return notify.LogNotifier{Logger: logger}, nil
+	case "webhook":
+		if cfg.notifier.webhookURL == "" {
+			return nil, errors.New("-notifier-webhook-url must be set when using the webhook notifier")
+		}
+
+		return notify.WebhookNotifier{
+			URL:    cfg.notifier.webhookURL,
+			Secret: []byte(os.Getenv(cfg.notifier.webhookSecretEnv)),
+			Client: &http.Client{Timeout: 10 * time.Second},
+		}, nil
+	case "none":
+		return notify.NopNotifier{}, nil
+	default:
+		return nil, fmt.Errorf("unknown notifier %q", cfg.notifier.backend)
+	}
+}
+
+func newKeyProvider(cfg config) (encryption.KeyProvider, error) {
+	switch cfg.encryption.provider {
+	case "env":
+		return encryption.EnvKeyProvider{
+			ID:  cfg.encryption.keyID,
+			Var: cfg.encryption.keyEnv,
+		}, nil
+	case "file":
+		if cfg.encryption.keyFile == "" {
+			return nil, errors.New("-encryption-key-file must be set when using the file key provider")
+		}
+
+		return encryption.FileKeyProvider{
+			ID:   cfg.encryption.keyID,
+			Path: cfg.encryption.keyFile,
+		}, nil
+	case "passphrase":
+		salt, err := hex.DecodeString(cfg.encryption.passphraseSalt)
+		if err != nil {
+			return nil, fmt.Errorf("-encryption-passphrase-salt must be hex encoded: %w", err)
+		}
+
+		return encryption.PassphraseKeyProvider{
+			ID:         cfg.encryption.keyID,
+			Passphrase: []byte(os.Getenv(cfg.encryption.passphraseEnv)),
+			Salt:       salt,
+			Time:       encryption.DefaultArgon2Time,
+			Memory:     encryption.DefaultArgon2Memory,
+			Threads:    encryption.DefaultArgon2Threads,
+		}, nil
+	case "transit":
+		return encryption.TransitKeyProvider{
+			ID:         cfg.encryption.keyID,
+			Addr:       cfg.encryption.transit.addr,
+			Mount:      cfg.encryption.transit.mount,
+			KeyName:    cfg.encryption.transit.keyName,
+			Token:      os.Getenv(cfg.encryption.transit.tokenEnv),
+			WrappedKey: cfg.encryption.transit.wrappedKey,
+			Client:     &http.Client{Timeout: 10 * time.Second},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown encryption key provider %q", cfg.encryption.provider)
+	}
+}
+
+// openKeyRing loads the encryption keys from the configured provider. With the
+// shamir provider the ring starts sealed, and the returned unsealer collects
+// key shares through the API until it can be unsealed.
+func openKeyRing(cfg config) (*encryption.KeyRing, *unsealer, error) {
+	if cfg.encryption.provider == "shamir" {
+		// Plaintext retired keys would sit in the environment, able to
+		// decrypt data, while the server is sealed.
+		if cfg.encryption.retiredKeys != "" {
+			return nil, nil, errors.New("-encryption-retired-keys must not be used with the shamir provider; pass the keys wrapped with -encryption-retired-keys-wrapped")
+		}
+
+		if cfg.encryption.unsealThreshold < 2 {
+			return nil, nil, errors.New("-unseal-threshold must be at least 2")
+		}
+
+		check, err := hex.DecodeString(cfg.encryption.unsealCheck)
+		if err != nil || len(check) == 0 {
+			return nil, nil, errors.New("-unseal-check must be set to the hex value printed by the init command")
+		}
+
+		u := &unsealer{
+			keyID:              cfg.encryption.keyID,
+			threshold:          cfg.encryption.unsealThreshold,
+			check:              check,
+			wrappedRetiredKeys: cfg.encryption.retiredKeysWrapped,
+		}
+
+		return encryption.NewSealedKeyRing(), u, nil
+	}
+
+	if cfg.encryption.retiredKeysWrapped != "" {
+		return nil, nil, errors.New("-encryption-retired-keys-wrapped is only used with the shamir provider")
+	}
+
+	retired, err := encryption.ParseKeys(cfg.encryption.retiredKeys)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	provider, err := newKeyProvider(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	active, err := provider.Key(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keys, err := encryption.NewKeyRing(active, retired...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return keys, nil, nil
+}
@@ -23,6 +23,21 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 	})
 }
 
+func (app *application) requireUnsealed(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/healthcheck", "/v1/sys/unseal":
+		default:
+			if app.keys.Sealed() {
+				app.sealedResponse(w, r)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Authorization")
@@ -59,6 +74,13 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
+		// Tokens issued before per-user data keys existed don't carry the
+		// key, so the user has to log in again to get one that does.
+		if user.HasDataKey() && !user.DataKeyUnlocked() {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
 		r = app.contextSetUser(r, user)
 
 		next.ServeHTTP(w, r)
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/robihdy/passman/internal/data"
+	"github.com/robihdy/passman/internal/notify"
+	"github.com/robihdy/passman/internal/validator"
+)
+
+// maxExpiringWithin is as far ahead as expiring logins can be looked for.
+const maxExpiringWithin = 3650 * 24 * time.Hour
+
+// expiringLoginsHandler lists the logins whose password has to be rotated
+// within the given time, overdue ones included, soonest first.
+func (app *application) expiringLoginsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Within time.Duration
+		Type   string
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Within = app.readDuration(qs, "within", 14*24*time.Hour, v)
+	input.Type = app.readItemType(r, v)
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = "rotation_due_at"
+	input.Filters.SortSafelist = []string{"rotation_due_at"}
+
+	v.Check(input.Within >= 0, "within", "must not be negative")
+	v.Check(input.Within <= maxExpiringWithin, "within", "must not be more than 3650d")
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	logins, metadata, err := app.models.Logins.GetExpiring(app.contextGetUser(r), input.Within, input.Type, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	for _, login := range logins {
+		login.MaskPassword()
+		login.MaskHiddenFields()
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{app.contextGetView(r).plural: logins, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// overdueBatchSize is the most reminders sent on each check. Anything left
+// over is picked up by the next one.
+const overdueBatchSize = 500
+
+// notifyOverdueRotations tells users about logins whose password has gone
+// overdue for rotation, checking every interval until stop is closed. Each
+// login is notified about once per due date; a reminder that fails to send is
+// tried again with a growing backoff. A zero interval turns reminders off.
+func (app *application) notifyOverdueRotations(stop <-chan struct{}) {
+	if app.config.rotation.checkInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(app.config.rotation.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			overdue, err := app.models.Logins.GetRotationOverdue(overdueBatchSize)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+				continue
+			}
+
+			sent := 0
+
+			for _, o := range overdue {
+				err := app.notifyOverdue(o)
+				if err != nil {
+					app.logger.PrintError(err, map[string]string{
+						"login_id": strconv.FormatInt(o.LoginID, 10),
+					})
+
+					err = app.models.Logins.MarkRotationFailed(o.LoginID)
+					if err != nil {
+						app.logger.PrintError(err, nil)
+					}
+					continue
+				}
+
+				sent++
+			}
+
+			if sent > 0 {
+				app.logger.PrintInfo("rotation reminders sent", map[string]string{
+					"logins": strconv.Itoa(sent),
+				})
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (app *application) notifyOverdue(o *data.OverdueLogin) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	err := app.notifier.Notify(ctx, notify.Notification{
+		Event:   "login.rotation_overdue",
+		UserID:  o.UserID,
+		Email:   o.UserEmail,
+		Message: "the password of " + o.LoginName + " is overdue for rotation",
+		Details: map[string]string{
+			"login_id":   strconv.FormatInt(o.LoginID, 10),
+			"login_name": o.LoginName,
+			"due_at":     o.DueAt.UTC().Format(time.RFC3339),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return app.models.Logins.MarkRotationNotified(o.LoginID)
+}
@@ -15,15 +15,56 @@ func (app *application) routes() http.Handler {
 
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
 
-	router.HandlerFunc(http.MethodGet, "/v1/logins", app.requirePermission(data.PermissionCodeLogins, app.listLoginsHandler))
-	router.HandlerFunc(http.MethodPost, "/v1/logins", app.requirePermission(data.PermissionCodeLogins, app.createLoginHandler))
-	router.HandlerFunc(http.MethodGet, "/v1/logins/:id", app.requirePermission(data.PermissionCodeLogins, app.showLoginHandler))
-	router.HandlerFunc(http.MethodPatch, "/v1/logins/:id", app.requirePermission(data.PermissionCodeLogins, app.updateLoginHandler))
-	router.HandlerFunc(http.MethodDelete, "/v1/logins/:id", app.requirePermission(data.PermissionCodeLogins, app.deleteLoginHandler))
+	// Logins are served both on their own and as one type among all the
+	// items of a vault.
+	for _, view := range []itemView{loginsView, itemsView} {
+		getActions := map[string]http.HandlerFunc{
+			"search":     app.searchLoginsHandler,
+			"match":      app.matchLoginsHandler,
+			"expiring":   app.expiringLoginsHandler,
+			"duplicates": app.listDuplicatesHandler,
+		}
+		postActions := map[string]http.HandlerFunc{
+			"batch": app.batchLoginsHandler,
+			"merge": app.mergeLoginsHandler,
+		}
+
+		router.HandlerFunc(http.MethodGet, view.path, app.requirePermission(data.PermissionCodeLogins, app.withView(view, app.listLoginsHandler)))
+		router.HandlerFunc(http.MethodPost, view.path, app.requirePermission(data.PermissionCodeLogins, app.withView(view, app.createLoginHandler)))
+		router.HandlerFunc(http.MethodGet, view.path+"/:id", app.requirePermission(data.PermissionCodeLogins, app.withView(view, app.withActions(app.showLoginHandler, getActions))))
+		router.HandlerFunc(http.MethodPost, view.path+"/:id", app.requirePermission(data.PermissionCodeLogins, app.withView(view, app.withActions(nil, postActions))))
+		router.HandlerFunc(http.MethodPatch, view.path+"/:id", app.requirePermission(data.PermissionCodeLogins, app.withView(view, app.updateLoginHandler)))
+		router.HandlerFunc(http.MethodDelete, view.path+"/:id", app.requirePermission(data.PermissionCodeLogins, app.withView(view, app.deleteLoginHandler)))
+		router.HandlerFunc(http.MethodPost, view.path+"/:id/use", app.requirePermission(data.PermissionCodeLogins, app.withView(view, app.useLoginHandler)))
+		router.HandlerFunc(http.MethodGet, view.path+"/:id/totp", app.requirePermission(data.PermissionCodeLogins, app.withView(view, app.showTOTPHandler)))
+		router.HandlerFunc(http.MethodGet, view.path+"/:id/revisions", app.requirePermission(data.PermissionCodeLogins, app.withView(view, app.listLoginRevisionsHandler)))
+		router.HandlerFunc(http.MethodPost, view.path+"/:id/revisions/:version/restore", app.requirePermission(data.PermissionCodeLogins, app.withView(view, app.restoreLoginRevisionHandler)))
+		router.HandlerFunc(http.MethodGet, view.path+"/:id/attachments", app.requirePermission(data.PermissionCodeLogins, app.withView(view, app.listAttachmentsHandler)))
+		router.HandlerFunc(http.MethodPost, view.path+"/:id/attachments", app.requirePermission(data.PermissionCodeLogins, app.withView(view, app.createAttachmentHandler)))
+		router.HandlerFunc(http.MethodGet, view.path+"/:id/attachments/:attachment_id", app.requirePermission(data.PermissionCodeLogins, app.withView(view, app.showAttachmentHandler)))
+		router.HandlerFunc(http.MethodDelete, view.path+"/:id/attachments/:attachment_id", app.requirePermission(data.PermissionCodeLogins, app.withView(view, app.deleteAttachmentHandler)))
+	}
+
+	router.HandlerFunc(http.MethodGet, "/v1/folders", app.requirePermission(data.PermissionCodeLogins, app.listFoldersHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/folders", app.requirePermission(data.PermissionCodeLogins, app.createFolderHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/folders/:id", app.requirePermission(data.PermissionCodeLogins, app.showFolderHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/folders/:id", app.requirePermission(data.PermissionCodeLogins, app.updateFolderHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/folders/:id", app.requirePermission(data.PermissionCodeLogins, app.deleteFolderHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/tags", app.requirePermission(data.PermissionCodeLogins, app.listTagsHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/trash", app.requirePermission(data.PermissionCodeLogins, app.listTrashHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/trash/:id/restore", app.requirePermission(data.PermissionCodeLogins, app.restoreTrashHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/generator/password", app.requireActivatedUser(app.generatePasswordHandler))
 
 	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/password", app.requireActivatedUser(app.updateUserPasswordHandler))
 
 	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
 
-	return app.recoverPanic(app.enableCORS(app.authenticate(router)))
+	router.HandlerFunc(http.MethodPost, "/v1/sys/unseal", app.unsealHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/sys/seal", app.requirePermission(data.PermissionCodeAdmin, app.sealHandler))
+
+	return app.recoverPanic(app.enableCORS(app.requireUnsealed(app.authenticate(router))))
 }
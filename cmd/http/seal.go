@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/robihdy/passman/internal/encryption"
+	"github.com/robihdy/passman/internal/shamir"
+)
+
+var errInvalidShares = errors.New("the submitted key shares are invalid; unseal progress has been reset")
+
+// unsealer collects key shares until enough have been submitted to rebuild
+// the master key and unseal the key ring. Retired keys are only held wrapped
+// with the master key, so nothing that can decrypt data is kept while the
+// server is sealed.
+type unsealer struct {
+	mu                 sync.Mutex
+	keyID              string
+	threshold          int
+	check              []byte
+	wrappedRetiredKeys string
+	shares             [][]byte
+}
+
+type sealStatus struct {
+	Sealed    bool `json:"sealed"`
+	Threshold int  `json:"threshold"`
+	Progress  int  `json:"progress"`
+}
+
+func (u *unsealer) reset() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.clear()
+}
+
+// clear wipes and forgets the shares submitted so far. u.mu must be held.
+func (u *unsealer) clear() {
+	for _, share := range u.shares {
+		wipe(share)
+	}
+
+	u.shares = nil
+}
+
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+func (u *unsealer) progress() int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return len(u.shares)
+}
+
+// submit adds a share. Once the threshold is reached the master key is
+// reconstructed, checked and loaded into keys.
+func (u *unsealer) submit(keys *encryption.KeyRing, share []byte) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if len(share) != encryption.KeySize+1 {
+		return errors.New("key share has the wrong length")
+	}
+
+	for _, s := range u.shares {
+		if bytes.Equal(s, share) {
+			return nil
+		}
+	}
+
+	u.shares = append(u.shares, share)
+	if len(u.shares) < u.threshold {
+		return nil
+	}
+
+	defer u.clear()
+
+	material, err := shamir.Combine(u.shares)
+	if err != nil {
+		return errInvalidShares
+	}
+
+	active, err := encryption.NewKey(u.keyID, material)
+	wipe(material)
+	if err != nil {
+		return errInvalidShares
+	}
+
+	if !encryption.VerifyKeyCheck(active, u.check) {
+		active.Wipe()
+		return errInvalidShares
+	}
+
+	retired, err := encryption.UnwrapKeys(active, u.wrappedRetiredKeys)
+	if err != nil {
+		active.Wipe()
+		return err
+	}
+
+	return keys.Unseal(active, retired...)
+}
+
+func (app *application) sealStatus() sealStatus {
+	status := sealStatus{Sealed: app.keys.Sealed()}
+
+	if app.unsealer != nil {
+		status.Threshold = app.unsealer.threshold
+		status.Progress = app.unsealer.progress()
+	}
+
+	return status
+}
+
+func (app *application) unsealHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Share string `json:"share"`
+		Reset bool   `json:"reset"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if app.unsealer == nil {
+		app.unsealNotSupportedResponse(w, r)
+		return
+	}
+
+	switch {
+	case input.Reset:
+		app.unsealer.reset()
+	case !app.keys.Sealed():
+		// Already unsealed; report the status without touching the ring.
+	default:
+		share, err := hex.DecodeString(input.Share)
+		if err != nil {
+			app.badRequestResponse(w, r, errors.New("key share must be hex encoded"))
+			return
+		}
+
+		err = app.unsealer.submit(app.keys, share)
+		if err != nil {
+			switch {
+			case errors.Is(err, errInvalidShares):
+				app.badRequestResponse(w, r, err)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if !app.keys.Sealed() {
+			app.logger.PrintInfo("server unsealed", nil)
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"seal_status": app.sealStatus()}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) sealHandler(w http.ResponseWriter, r *http.Request) {
+	if app.unsealer == nil {
+		app.unsealNotSupportedResponse(w, r)
+		return
+	}
+
+	app.keys.Seal()
+	app.unsealer.reset()
+
+	app.logger.PrintInfo("server sealed", map[string]string{
+		"user_id": strconv.FormatInt(app.contextGetUser(r).ID, 10),
+	})
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"seal_status": app.sealStatus()}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -21,6 +21,11 @@ func (app *application) serve() error {
 	}
 
 	shutdownError := make(chan error)
+	stopJobs := make(chan struct{})
+
+	go app.purgeTrash(stopJobs)
+	go app.pruneRevisions(stopJobs)
+	go app.notifyOverdueRotations(stopJobs)
 
 	go func() {
 		quit := make(chan os.Signal, 1)
@@ -31,6 +36,8 @@ func (app *application) serve() error {
 			"signal": s.String(),
 		})
 
+		close(stopJobs)
+
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
@@ -53,7 +53,37 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 
-	token, err := app.models.Tokens.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+	if user.HasDataKey() {
+		err = user.Password.Unlock(input.Password)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	} else {
+		// The account predates per-user data keys. Setting the password again
+		// generates the user's key, which their existing logins are then
+		// sealed with.
+		err = app.upgradeDataKey(user, input.Password)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				app.editConflictResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+	}
+
+	// Notes written before they were sealed can only be sealed now, while
+	// the user's data key is unlocked.
+	err = app.models.Logins.SealNotes(user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	token, err := app.models.Tokens.New(user, 24*time.Hour, data.ScopeAuthentication)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -64,3 +94,12 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+func (app *application) upgradeDataKey(user *data.User, password string) error {
+	err := user.Password.Set(password)
+	if err != nil {
+		return err
+	}
+
+	return app.models.Logins.SealWithDataKey(user)
+}
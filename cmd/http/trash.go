@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/robihdy/passman/internal/data"
+	"github.com/robihdy/passman/internal/validator"
+)
+
+func (app *application) listTrashHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-deleted_at")
+	input.Filters.SortSafelist = []string{"id", "name", "deleted_at", "-id", "-name", "-deleted_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	logins, metadata, err := app.models.Logins.GetTrash(app.contextGetUser(r), input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	for _, login := range logins {
+		login.MaskPassword()
+		login.MaskHiddenFields()
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{itemsView.plural: logins, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) restoreTrashHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	login, err := app.models.Logins.RestoreFromTrash(id, app.contextGetUser(r), app.config.limits.maxLogins)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrLoginQuota):
+			app.quotaExceededResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	login.MaskHiddenFields()
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(login.Version))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{itemsView.singular: login}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// purgeTrash permanently deletes logins that have outlived the trash
+// retention period, checking every interval until stop is closed. A zero
+// interval turns purging off.
+func (app *application) purgeTrash(stop <-chan struct{}) {
+	if app.config.trash.purgeInterval <= 0 {
+		return
+	}
+
+	retention := time.Duration(app.config.trash.retentionDays) * 24 * time.Hour
+
+	ticker := time.NewTicker(app.config.trash.purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// An error may still come with logins purged, if some of their
+			// attachment blobs couldn't be deleted afterwards.
+			n, err := app.models.Logins.PurgeTrash(retention)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+
+			if n > 0 {
+				app.logger.PrintInfo("trash purged", map[string]string{
+					"logins": strconv.FormatInt(n, 10),
+				})
+			}
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"os"
+
+	"github.com/robihdy/passman/internal/encryption"
+	"github.com/robihdy/passman/internal/jsonlog"
+	"github.com/robihdy/passman/internal/shamir"
+)
+
+// The init command generates a new master encryption key and splits it into
+// key shares for the shamir key provider. The key itself is never written
+// anywhere; only the shares and a check value are printed, and the server is
+// started with:
+//
+//	-encryption-key-provider=shamir -encryption-key-id=<key_id> -unseal-threshold=<threshold> -unseal-check=<unseal_check>
+//
+// Keys being rotated out are read from the environment variable named by
+// -retired-keys-env and printed wrapped with the new key, to be passed to the
+// server with -encryption-retired-keys-wrapped. They can then be removed from
+// the environment: the server only unwraps them once it is unsealed.
+func main() {
+	var (
+		shares         int
+		threshold      int
+		keyID          string
+		retiredKeysEnv string
+	)
+
+	flag.IntVar(&shares, "shares", 5, "Number of key shares to generate")
+	flag.IntVar(&threshold, "threshold", 3, "Number of key shares needed to unseal the server")
+	flag.StringVar(&keyID, "key-id", "default", "ID recorded in ciphertexts sealed with the generated key")
+	flag.StringVar(&retiredKeysEnv, "retired-keys-env", "", "Environment variable holding retired keys to wrap with the generated key (space separated id:hex pairs)")
+
+	flag.Parse()
+
+	logger := jsonlog.New(os.Stderr, jsonlog.LevelInfo)
+
+	var retired []*encryption.Key
+
+	if retiredKeysEnv != "" {
+		var err error
+
+		retired, err = encryption.ParseKeys(os.Getenv(retiredKeysEnv))
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+	}
+
+	material := make([]byte, encryption.KeySize)
+
+	_, err := rand.Read(material)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	key, err := encryption.NewKey(keyID, material)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	check, err := encryption.NewKeyCheck(key)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	wrapped, err := encryption.WrapKeys(key, retired)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	for _, k := range retired {
+		k.Wipe()
+	}
+
+	parts, err := shamir.Split(material, shares, threshold)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	for i := range material {
+		material[i] = 0
+	}
+
+	output := struct {
+		KeyID              string   `json:"key_id"`
+		Threshold          int      `json:"threshold"`
+		UnsealCheck        string   `json:"unseal_check"`
+		RetiredKeysWrapped string   `json:"retired_keys_wrapped,omitempty"`
+		Shares             []string `json:"shares"`
+	}{
+		KeyID:              keyID,
+		Threshold:          threshold,
+		UnsealCheck:        hex.EncodeToString(check),
+		RetiredKeysWrapped: wrapped,
+	}
+
+	for _, part := range parts {
+		output.Shares = append(output.Shares, hex.EncodeToString(part))
+	}
+
+	js, err := json.MarshalIndent(output, "", "\t")
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	os.Stdout.Write(append(js, '\n'))
+}
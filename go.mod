@@ -1,6 +1,6 @@
 module github.com/robihdy/passman
 
-go 1.15
+go 1.20
 
 require (
 	github.com/julienschmidt/httprouter v1.3.0
@@ -8,3 +8,5 @@ require (
 	golang.org/x/crypto v0.0.0-20210711020723-a769d52b0f97
 	gopkg.in/guregu/null.v4 v4.0.0
 )
+
+require golang.org/x/sys v0.0.0-20210615035016-665e8c7367d1 // indirect
@@ -0,0 +1,29 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+var (
+	ErrNotFound   = errors.New("blob: not found")
+	ErrInvalidKey = errors.New("blob: invalid key")
+)
+
+// Store keeps opaque blobs by key. It lets attachments live wherever
+// operations prefer (a local directory now, an object store later) without the
+// rest of the code caring. Blobs are written once and never modified.
+type Store interface {
+	// Put stores everything read from r under key. The blob only becomes
+	// visible once it has been written in full.
+	Put(ctx context.Context, key string, r io.Reader) error
+
+	// Get opens the blob stored under key. It returns ErrNotFound if there
+	// is none.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+
+	// Delete removes the blob stored under key. Deleting a blob that does
+	// not exist is not an error.
+	Delete(ctx context.Context, key string) error
+}
@@ -0,0 +1,112 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// LocalStore keeps blobs as files under a directory on the local filesystem.
+// Files are spread over subdirectories named after the first two characters
+// of their key so that no single directory grows too large.
+type LocalStore struct {
+	Root string
+}
+
+// NewLocalStore returns a LocalStore rooted at dir, creating it if needed.
+// The directory is only accessible by its owner.
+func NewLocalStore(dir string) (*LocalStore, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LocalStore{Root: dir}, nil
+}
+
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename it into place so that a failed
+	// or interrupted upload never leaves a partial blob behind.
+	f, err := ioutil.TempFile(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = io.Copy(f, r)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+func (s *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// path maps a key to its file. Keys are restricted to lowercase hex so that
+// they can never escape the root directory.
+func (s *LocalStore) path(key string) (string, error) {
+	if len(key) < 3 || len(key) > 128 {
+		return "", ErrInvalidKey
+	}
+
+	for _, c := range key {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return "", ErrInvalidKey
+		}
+	}
+
+	return filepath.Join(s.Root, key[:2], key), nil
+}
@@ -0,0 +1,485 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/robihdy/passman/internal/blob"
+	"github.com/robihdy/passman/internal/encryption"
+	"github.com/robihdy/passman/internal/validator"
+)
+
+var (
+	ErrAttachmentTooLarge = errors.New("attachment too large")
+	ErrStorageQuota       = errors.New("storage quota exceeded")
+)
+
+// attachmentKeyID names the per-attachment file keys. Each attachment has its
+// own key, so the ID only needs to tell it apart from other kinds of key.
+const attachmentKeyID = "attachment"
+
+// Attachment is a file stored alongside a login, such as a certificate or a
+// list of recovery codes. Its contents are encrypted chunk by chunk with a
+// key of its own, which is in turn sealed like any other secret field of the
+// login, and kept in the blob store rather than the database.
+type Attachment struct {
+	ID          int64     `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	LoginID     int64     `json:"login_id"`
+	Name        string    `json:"name"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+
+	blobKey string
+	fileKey []byte
+}
+
+func ValidateAttachment(v *validator.Validator, attachment *Attachment) {
+	v.Check(strings.TrimSpace(attachment.Name) != "", "name", "must be provided")
+	v.Check(len(attachment.Name) <= 255, "name", "must not be more than 255 bytes long")
+	v.Check(!strings.ContainsAny(attachment.Name, `/\`), "name", "must not contain a slash")
+	v.Check(strings.IndexFunc(attachment.Name, unicode.IsControl) == -1, "name", "must not contain control characters")
+
+	_, _, err := mime.ParseMediaType(attachment.ContentType)
+	v.Check(err == nil, "content_type", "must be a valid media type")
+	v.Check(len(attachment.ContentType) <= 255, "content_type", "must not be more than 255 bytes long")
+}
+
+// attachmentField is the name the attachment's file key is sealed under,
+// binding it to the attachment as well as the login.
+func attachmentField(attachmentID int64) string {
+	return fmt.Sprintf("attachments:%d", attachmentID)
+}
+
+// attachmentAD binds an attachment's encrypted contents to the attachment, so
+// a blob swapped for another fails to decrypt.
+func attachmentAD(userID, loginID, attachmentID int64) []byte {
+	return []byte(fmt.Sprintf("attachments:%d:%d:%d", userID, loginID, attachmentID))
+}
+
+// limitedReader reads from r but fails with ErrAttachmentTooLarge once more
+// than n bytes have been read.
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n, ErrAttachmentTooLarge
+	}
+
+	return n, err
+}
+
+type AttachmentModel struct {
+	DB      *sql.DB
+	Keys    *encryption.KeyRing
+	Blobs   blob.Store
+	MaxSize int64
+	Quota   int64
+}
+
+// logins returns the LoginModel used to seal and open file keys, so they are
+// protected exactly like the login's other secret fields.
+func (m AttachmentModel) logins() LoginModel {
+	return LoginModel{DB: m.DB, Keys: m.Keys, Blobs: m.Blobs}
+}
+
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func storageUsed(ctx context.Context, q queryer, userID int64) (int64, error) {
+	query := `
+        SELECT COALESCE(SUM(size), 0)
+        FROM attachments
+        WHERE user_id = $1`
+
+	var used int64
+
+	err := q.QueryRowContext(ctx, query, userID).Scan(&used)
+	return used, err
+}
+
+// Insert encrypts everything read from r and stores it as a new attachment
+// on the login. The contents are streamed straight to the blob store, and
+// reading stops with ErrAttachmentTooLarge or ErrStorageQuota as soon as
+// they would take the attachment past MaxSize or the user past their Quota.
+func (m AttachmentModel) Insert(attachment *Attachment, r io.Reader, user *User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	used, err := storageUsed(ctx, m.DB, user.ID)
+	if err != nil {
+		return err
+	}
+
+	limit, limitErr := m.MaxSize, ErrAttachmentTooLarge
+	if remaining := m.Quota - used; remaining < limit {
+		limit, limitErr = remaining, ErrStorageQuota
+	}
+
+	if limit < 0 {
+		return ErrStorageQuota
+	}
+
+	err = m.DB.QueryRowContext(ctx, `SELECT nextval('attachments_id_seq')`).Scan(&attachment.ID)
+	if err != nil {
+		return err
+	}
+
+	material := make([]byte, encryption.KeySize)
+	if _, err := rand.Read(material); err != nil {
+		return err
+	}
+
+	fileKey, err := encryption.NewKey(attachmentKeyID, material)
+	if err != nil {
+		return err
+	}
+
+	attachment.fileKey, err = m.logins().seal(string(material), user, attachment.LoginID, attachmentField(attachment.ID))
+	if err != nil {
+		return err
+	}
+
+	blobKey := make([]byte, 16)
+	if _, err := rand.Read(blobKey); err != nil {
+		return err
+	}
+	attachment.blobKey = hex.EncodeToString(blobKey)
+
+	// Encrypt in a goroutine so the blob store can read the ciphertext as it
+	// is produced.
+	pr, pw := io.Pipe()
+	encrypted := make(chan error, 1)
+
+	go func() {
+		src := &limitedReader{r: r, n: limit}
+
+		size, err := fileKey.EncryptStream(pw, src, attachmentAD(user.ID, attachment.LoginID, attachment.ID))
+		attachment.Size = size
+		pw.CloseWithError(err)
+		encrypted <- err
+	}()
+
+	err = m.Blobs.Put(context.Background(), attachment.blobKey, pr)
+	pr.Close()
+
+	// Closing the pipe stops the encryption if the blob store gave up early,
+	// in which case its error is the one that matters.
+	if encryptErr := <-encrypted; encryptErr != nil && !errors.Is(encryptErr, io.ErrClosedPipe) {
+		err = encryptErr
+	}
+	if errors.Is(err, ErrAttachmentTooLarge) {
+		err = limitErr
+	}
+	if err != nil {
+		m.deleteBlob(attachment.blobKey)
+		return err
+	}
+
+	err = m.insertRow(attachment, user)
+	if err != nil {
+		m.deleteBlob(attachment.blobKey)
+		return err
+	}
+
+	return nil
+}
+
+// insertRow records an attachment whose contents have been stored. The
+// user's row is locked while their storage is totted up, so concurrent
+// uploads cannot together take them past their quota.
+func (m AttachmentModel) insertRow(attachment *Attachment, user *User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `SELECT id FROM users WHERE id = $1 FOR UPDATE`, user.ID)
+	if err != nil {
+		return err
+	}
+
+	used, err := storageUsed(ctx, tx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	if used+attachment.Size > m.Quota {
+		return ErrStorageQuota
+	}
+
+	query := `
+        INSERT INTO attachments (id, login_id, user_id, name, content_type, size, blob_key, file_key, key_id)
+        SELECT $1, id, user_id, $2, $3, $4, $5, $6, $7
+        FROM logins
+        WHERE id = $8 AND user_id = $9 AND deleted_at IS NULL
+        RETURNING created_at`
+
+	args := []interface{}{
+		attachment.ID,
+		attachment.Name,
+		attachment.ContentType,
+		attachment.Size,
+		attachment.blobKey,
+		attachment.fileKey,
+		m.Keys.ActiveID(),
+		attachment.LoginID,
+		user.ID,
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&attachment.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// deleteBlob removes the blob of an attachment that was never recorded.
+func (m AttachmentModel) deleteBlob(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	m.Blobs.Delete(ctx, key)
+}
+
+const attachmentColumns = `id, created_at, login_id, name, content_type, size, blob_key, file_key`
+
+func scanAttachment(row rowScanner) (*Attachment, error) {
+	var attachment Attachment
+
+	err := row.Scan(
+		&attachment.ID,
+		&attachment.CreatedAt,
+		&attachment.LoginID,
+		&attachment.Name,
+		&attachment.ContentType,
+		&attachment.Size,
+		&attachment.blobKey,
+		&attachment.fileKey,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &attachment, nil
+}
+
+func (m AttachmentModel) Get(id, loginID int64, user *User) (*Attachment, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+        SELECT ` + attachmentColumns + `
+        FROM attachments
+        WHERE id = $1 AND login_id = $2 AND user_id = $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	attachment, err := scanAttachment(m.DB.QueryRowContext(ctx, query, id, loginID, user.ID))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return attachment, nil
+}
+
+// GetAllForLogin returns the login's attachments, oldest first.
+func (m AttachmentModel) GetAllForLogin(loginID int64, user *User) ([]*Attachment, error) {
+	query := `
+        SELECT ` + attachmentColumns + `
+        FROM attachments
+        WHERE login_id = $1 AND user_id = $2
+        ORDER BY created_at, id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, loginID, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := []*Attachment{}
+
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		attachments = append(attachments, attachment)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return attachments, nil
+}
+
+// Open returns a reader over the decrypted contents of the attachment. The
+// contents are decrypted as they are read; a blob that has been tampered with
+// makes Read fail at the first chunk that doesn't authenticate. The reader
+// must be closed.
+func (m AttachmentModel) Open(attachment *Attachment, user *User) (io.ReadCloser, error) {
+	material, err := m.logins().open(attachment.fileKey, schemeUserEnvelope, user, attachment.LoginID, attachmentField(attachment.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	fileKey, err := encryption.NewKey(attachmentKeyID, []byte(material))
+	if err != nil {
+		return nil, err
+	}
+
+	src, err := m.Blobs.Get(context.Background(), attachment.blobKey)
+	if err != nil {
+		return nil, fmt.Errorf("attachment %d: %w", attachment.ID, err)
+	}
+
+	pr, pw := io.Pipe()
+
+	go func() {
+		_, err := fileKey.DecryptStream(pw, src, attachmentAD(user.ID, attachment.LoginID, attachment.ID))
+		src.Close()
+		pw.CloseWithError(err)
+	}()
+
+	return pr, nil
+}
+
+// Delete removes the attachment and its blob.
+func (m AttachmentModel) Delete(attachment *Attachment, user *User) error {
+	query := `
+        DELETE FROM attachments
+        WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, attachment.ID, user.ID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return m.Blobs.Delete(ctx, attachment.blobKey)
+}
+
+// reencryptAttachmentBatch is the attachments counterpart of reencryptBatch.
+// Only the sealed file keys are re-encrypted; the blobs themselves are sealed
+// with the file keys and don't change.
+func (m LoginModel) reencryptAttachmentBatch(batchSize int) (int, error) {
+	query := `
+        SELECT id, login_id, user_id, file_key
+        FROM attachments
+        WHERE key_id IS DISTINCT FROM $1
+        ORDER BY id
+        LIMIT $2
+        FOR UPDATE SKIP LOCKED`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, m.Keys.ActiveID(), batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	type row struct {
+		id      int64
+		loginID int64
+		userID  int64
+		fileKey []byte
+	}
+
+	var batch []row
+
+	for rows.Next() {
+		var r row
+
+		err := rows.Scan(&r.id, &r.loginID, &r.userID, &r.fileKey)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		batch = append(batch, r)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, r := range batch {
+		fileKey, err := m.rewrap(r.fileKey, r.userID, r.loginID, attachmentField(r.id))
+		if err != nil {
+			return 0, err
+		}
+
+		query := `
+            UPDATE attachments
+            SET file_key = $1, key_id = $2
+            WHERE id = $3`
+
+		_, err = tx.ExecContext(ctx, query, fileKey, m.Keys.ActiveID(), r.id)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return len(batch), nil
+}
@@ -0,0 +1,85 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrBatchRolledBack is the result of every operation of an all-or-nothing
+// batch that was undone, or never run, because another operation failed.
+var ErrBatchRolledBack = errors.New("rolled back because another operation in the batch failed")
+
+// BatchStep is one operation of a batch. It is run inside the batch's
+// transaction, typically through the Tx methods of LoginModel.
+type BatchStep func(ctx context.Context, tx *sql.Tx) error
+
+// RunBatch runs steps in order in a single transaction and returns what each
+// of them returned and whether the transaction was committed. If atomic, the
+// first step to fail rolls back the whole batch and every other step gets
+// ErrBatchRolledBack. Otherwise each step is wrapped in a savepoint, so a
+// failed step is undone on its own and the rest are committed. The error is
+// only set if the transaction itself failed, or if prepare did.
+//
+// prepare, if not nil, is run in the transaction before any step, for checks
+// that apply to the batch as a whole. If it fails no step is run.
+func (m LoginModel) RunBatch(atomic bool, prepare BatchStep, steps []BatchStep) ([]error, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	results := make([]error, len(steps))
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	if prepare != nil {
+		err = prepare(ctx, tx)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	for i, step := range steps {
+		if atomic {
+			results[i] = step(ctx, tx)
+			if results[i] != nil {
+				for j := range results {
+					if j != i {
+						results[j] = ErrBatchRolledBack
+					}
+				}
+
+				return results, false, nil
+			}
+
+			continue
+		}
+
+		_, err = tx.ExecContext(ctx, "SAVEPOINT batch_step")
+		if err != nil {
+			return nil, false, err
+		}
+
+		results[i] = step(ctx, tx)
+
+		if results[i] != nil {
+			_, err = tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT batch_step")
+		} else {
+			_, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT batch_step")
+		}
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, false, err
+	}
+
+	return results, true, nil
+}
@@ -0,0 +1,330 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"gopkg.in/guregu/null.v4"
+)
+
+// DuplicateGroup is a set of logins that look like the same credential: their
+// websites share a base domain and their usernames are the same but for case.
+type DuplicateGroup struct {
+	Website  string   `json:"website"`
+	Username string   `json:"username"`
+	Logins   []*Login `json:"logins"`
+}
+
+// duplicateKey is what logins that duplicate each other have in common. Only
+// standard logins with a website and a username have one; the server can't
+// see inside zero-knowledge ones.
+type duplicateKey struct {
+	website  string
+	username string
+}
+
+func newDuplicateKey(website null.String, username string) (duplicateKey, bool) {
+	if !website.Valid || username == "" {
+		return duplicateKey{}, false
+	}
+
+	u, err := url.Parse(website.String)
+	if err != nil || u.Hostname() == "" {
+		return duplicateKey{}, false
+	}
+
+	return duplicateKey{website: baseDomain(u.Hostname()), username: strings.ToLower(username)}, true
+}
+
+// GetDuplicates groups the user's logins that duplicate each other. With
+// samePassword, logins only count as duplicates if their passwords match too.
+// Only the website and username of every login are read at first; just the
+// logins that turn out to have duplicates are fetched and decrypted.
+func (m LoginModel) GetDuplicates(user *User, samePassword bool) ([]*DuplicateGroup, error) {
+	query := `
+        SELECT id, website, username
+        FROM logins
+        WHERE user_id = $1 AND deleted_at IS NULL AND mode = 'standard' AND type = 'login'
+        AND website IS NOT NULL AND username <> ''
+        ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	candidates := make(map[duplicateKey][]int64)
+
+	for rows.Next() {
+		var (
+			id       int64
+			website  null.String
+			username string
+		)
+
+		if err := rows.Scan(&id, &website, &username); err != nil {
+			return nil, err
+		}
+
+		if key, ok := newDuplicateKey(website, username); ok {
+			candidates[key] = append(candidates[key], id)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var ids []int64
+
+	for _, group := range candidates {
+		if len(group) > 1 {
+			ids = append(ids, group...)
+		}
+	}
+
+	groups := []*DuplicateGroup{}
+
+	if len(ids) == 0 {
+		return groups, nil
+	}
+
+	query = `
+        SELECT ` + loginColumns + `
+        FROM logins
+        WHERE id = ANY($1) AND user_id = $2 AND deleted_at IS NULL
+        ORDER BY id`
+
+	rows, err = m.DB.QueryContext(ctx, query, pq.Array(ids), user.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byKey := make(map[duplicateKey]*DuplicateGroup)
+	var keys []duplicateKey
+
+	for rows.Next() {
+		login, err := m.scanLogin(rows, user)
+		if err != nil {
+			return nil, err
+		}
+
+		key, _ := newDuplicateKey(login.Website, login.Username)
+
+		if byKey[key] == nil {
+			byKey[key] = &DuplicateGroup{Website: key.website, Username: key.username}
+			keys = append(keys, key)
+		}
+
+		byKey[key].Logins = append(byKey[key].Logins, login)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].website != keys[j].website {
+			return keys[i].website < keys[j].website
+		}
+		return keys[i].username < keys[j].username
+	})
+
+	for _, key := range keys {
+		group := byKey[key]
+
+		if !samePassword {
+			if len(group.Logins) > 1 {
+				groups = append(groups, group)
+			}
+			continue
+		}
+
+		byPassword := make(map[string]*DuplicateGroup)
+		var passwords []string
+
+		for _, login := range group.Logins {
+			if byPassword[login.Password] == nil {
+				byPassword[login.Password] = &DuplicateGroup{Website: group.Website, Username: group.Username}
+				passwords = append(passwords, login.Password)
+			}
+
+			byPassword[login.Password].Logins = append(byPassword[login.Password].Logins, login)
+		}
+
+		for _, password := range passwords {
+			if len(byPassword[password].Logins) > 1 {
+				groups = append(groups, byPassword[password])
+			}
+		}
+	}
+
+	return groups, nil
+}
+
+// FindDuplicates returns the IDs of the user's logins that the given login,
+// which need not be stored yet, would duplicate.
+func (m LoginModel) FindDuplicates(login *Login, user *User) ([]int64, error) {
+	ids := []int64{}
+
+	if login.Mode != ModeStandard || login.Type != TypeLogin {
+		return ids, nil
+	}
+
+	key, ok := newDuplicateKey(primaryURI(login.URIs), login.Username)
+	if !ok {
+		return ids, nil
+	}
+
+	query := `
+        SELECT id, website, username
+        FROM logins
+        WHERE user_id = $1 AND deleted_at IS NULL AND mode = 'standard' AND type = 'login'
+        AND lower(username) = $2 AND id <> $3
+        ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, user.ID, key.username, login.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id       int64
+			website  null.String
+			username string
+		)
+
+		if err := rows.Scan(&id, &website, &username); err != nil {
+			return nil, err
+		}
+
+		if other, ok := newDuplicateKey(website, username); ok && other == key {
+			ids = append(ids, id)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// Absorb folds what other holds that login doesn't into login: its URIs,
+// tags, notes, custom fields under names login doesn't use yet, a TOTP secret
+// if login has none, and being a favorite. Login keeps its own password and
+// everything else it already has.
+func (l *Login) Absorb(other *Login) {
+	l.URIs = NormalizeURIs(append(append([]URI{}, l.URIs...), other.URIs...))
+	l.Tags = NormalizeTags(append(append([]string{}, l.Tags...), other.Tags...))
+
+	if other.Notes != "" && !strings.Contains(l.Notes, other.Notes) {
+		if l.Notes != "" {
+			l.Notes += "\n\n"
+		}
+		l.Notes += other.Notes
+	}
+
+	names := make(map[string]bool)
+	for _, field := range l.Fields {
+		names[field.Name] = true
+	}
+
+	for _, field := range other.Fields {
+		if !names[field.Name] {
+			names[field.Name] = true
+			l.Fields = append(l.Fields, field)
+		}
+	}
+
+	if l.TOTP == "" {
+		l.TOTP = other.TOTP
+	}
+
+	l.Favorite = l.Favorite || other.Favorite
+}
+
+// Merge saves login, which has absorbed others, and moves the others to the
+// trash marked as merged into it, all in one transaction. The state login
+// had before is kept in its history like any other update's, and the merged
+// logins keep theirs: restoring one from the trash brings it back whole.
+// Their usage is added to login's.
+func (m LoginModel) Merge(login *Login, others []*Login, user *User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = m.UpdateTx(ctx, tx, login, user)
+	if err != nil {
+		return err
+	}
+
+	query := `
+        UPDATE logins
+        SET deleted_at = NOW(), merged_into_id = $1, version = version + 1
+        WHERE id = $2 AND user_id = $3 AND version = $4 AND deleted_at IS NULL
+        RETURNING use_count, last_used_at`
+
+	var (
+		useCount   int
+		lastUsedAt *time.Time
+	)
+
+	for _, other := range others {
+		var (
+			count int
+			used  *time.Time
+		)
+
+		err = tx.QueryRowContext(ctx, query, login.ID, other.ID, user.ID, other.Version).Scan(&count, &used)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrEditConflict
+			default:
+				return err
+			}
+		}
+
+		useCount += count
+		if used != nil && (lastUsedAt == nil || used.After(*lastUsedAt)) {
+			lastUsedAt = used
+		}
+	}
+
+	// GREATEST ignores NULLs, so a login that was never used takes the
+	// others' last use.
+	query = `
+        UPDATE logins
+        SET use_count = use_count + $1, last_used_at = GREATEST(last_used_at, $2)
+        WHERE id = $3
+        RETURNING use_count, last_used_at`
+
+	err = tx.QueryRowContext(ctx, query, useCount, lastUsedAt, login.ID).Scan(&login.UseCount, &login.LastUsedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,241 @@
+package data
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/robihdy/passman/internal/validator"
+)
+
+// Custom field types. Hidden fields are secrets and are encrypted like the
+// password; the others are stored as they are.
+const (
+	FieldText    = "text"
+	FieldHidden  = "hidden"
+	FieldBoolean = "boolean"
+	FieldURL     = "url"
+)
+
+const (
+	maxFieldsPerLogin = 50
+	maxFieldNameBytes = 100
+	maxFieldValueSize = 5000
+	maxFieldIDBytes   = 64
+)
+
+// Field is a custom field of a login, such as an account ID or the answer to
+// a security question. ID identifies the field across updates, so it can be
+// renamed; it is assigned when the field is first stored. The value of a
+// hidden field is left out, and Masked set, unless the caller asked for it to
+// be revealed.
+type Field struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Value  string `json:"value"`
+	Masked bool   `json:"masked,omitempty"`
+}
+
+// storedField is how a field is kept in the logins.fields column. Hidden
+// values are sealed into Secret and never written to Value.
+type storedField struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Value  string `json:"value,omitempty"`
+	Secret []byte `json:"secret,omitempty"`
+}
+
+func validateFields(v *validator.Validator, fields []Field) {
+	v.Check(len(fields) <= maxFieldsPerLogin, "fields", "must not contain more than 50 fields")
+
+	names := make([]string, len(fields))
+	ids := []string{}
+
+	for i, field := range fields {
+		key := fmt.Sprintf("fields[%d]", i)
+
+		names[i] = field.Name
+
+		if field.ID != "" {
+			ids = append(ids, field.ID)
+		}
+
+		v.Check(len(field.ID) <= maxFieldIDBytes, key+".id", "must not be more than 64 bytes long")
+		v.Check(!field.Masked, key+".masked", "must only be set on a hidden field of the login being updated")
+
+		v.Check(field.Name != "", key+".name", "must be provided")
+		v.Check(len(field.Name) <= maxFieldNameBytes, key+".name", "must not be more than 100 bytes long")
+		v.Check(validator.In(field.Type, FieldText, FieldHidden, FieldBoolean, FieldURL), key+".type", "must be text, hidden, boolean or url")
+		v.Check(len(field.Value) <= maxFieldValueSize, key+".value", "must not be more than 5000 bytes long")
+
+		switch field.Type {
+		case FieldBoolean:
+			v.Check(validator.In(field.Value, "true", "false"), key+".value", "must be true or false")
+		case FieldURL:
+			u, err := url.Parse(field.Value)
+			v.Check(err == nil && u.Scheme != "" && u.Host != "", key+".value", "must be an absolute URL")
+		}
+	}
+
+	v.Check(validator.Unique(names), "fields", "must not contain two fields with the same name")
+	v.Check(validator.Unique(ids), "fields", "must not contain two fields with the same id")
+}
+
+// MaskHiddenFields blanks out the values of the login's hidden fields.
+func (l *Login) MaskHiddenFields() {
+	maskFields(l.Fields)
+}
+
+// MaskHiddenFields blanks out the values of the revision's hidden fields.
+func (r *LoginRevision) MaskHiddenFields() {
+	maskFields(r.Fields)
+}
+
+func maskFields(fields []Field) {
+	for i := range fields {
+		if fields[i].Type == FieldHidden {
+			fields[i].Value = ""
+			fields[i].Masked = true
+		}
+	}
+}
+
+// KeepHiddenValues carries over, from the login's previous fields, the value
+// of every hidden field that was sent back masked. The previous field is found
+// by ID, so a masked field can be renamed. Any other field is taken as it is,
+// so an empty value clears a hidden field.
+func KeepHiddenValues(v *validator.Validator, fields, previous []Field) {
+	values := make(map[string]string)
+
+	for _, field := range previous {
+		if field.Type == FieldHidden && field.ID != "" {
+			values[field.ID] = field.Value
+		}
+	}
+
+	for i := range fields {
+		if !fields[i].Masked {
+			continue
+		}
+
+		key := fmt.Sprintf("fields[%d]", i)
+
+		value, ok := values[fields[i].ID]
+
+		v.Check(ok && fields[i].Type == FieldHidden, key+".id", "must be the id of a hidden field of the login")
+		v.Check(fields[i].Value == "", key+".value", "must not be provided for a masked field")
+
+		fields[i].Value = value
+		fields[i].Masked = false
+	}
+}
+
+// newFieldID returns a random ID for a field that is stored for the first
+// time.
+func newFieldID() (string, error) {
+	b := make([]byte, 8)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// fieldAD names a custom field in the additional data of its ciphertext, so a
+// hidden value can't be moved to another field.
+func fieldAD(name string) string {
+	return "fields:" + name
+}
+
+// sealFields encodes a login's custom fields for storage, sealing hidden
+// values. Fields without an ID are given one.
+func (m LoginModel) sealFields(login *Login, user *User) ([]byte, error) {
+	stored := make([]storedField, len(login.Fields))
+
+	for i := range login.Fields {
+		if login.Fields[i].ID == "" {
+			id, err := newFieldID()
+			if err != nil {
+				return nil, err
+			}
+
+			login.Fields[i].ID = id
+		}
+
+		field := login.Fields[i]
+
+		stored[i] = storedField{ID: field.ID, Name: field.Name, Type: field.Type}
+
+		if field.Type != FieldHidden {
+			stored[i].Value = field.Value
+			continue
+		}
+
+		secret, err := m.seal(field.Value, user, login.ID, fieldAD(field.Name))
+		if err != nil {
+			return nil, err
+		}
+
+		stored[i].Secret = secret
+	}
+
+	return json.Marshal(stored)
+}
+
+// openFields decodes custom fields read from the database, opening hidden
+// values.
+func (m LoginModel) openFields(raw []byte, user *User, loginID int64) ([]Field, error) {
+	var stored []storedField
+
+	err := json.Unmarshal(raw, &stored)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]Field, len(stored))
+
+	for i, s := range stored {
+		fields[i] = Field{ID: s.ID, Name: s.Name, Type: s.Type, Value: s.Value}
+
+		if s.Type != FieldHidden {
+			continue
+		}
+
+		fields[i].Value, err = m.open(s.Secret, schemeUserEnvelope, user, loginID, fieldAD(s.Name))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return fields, nil
+}
+
+// rewrapFields re-encrypts the server key ring layer of every hidden value,
+// for Reencrypt.
+func (m LoginModel) rewrapFields(raw []byte, userID, loginID int64) ([]byte, error) {
+	var stored []storedField
+
+	err := json.Unmarshal(raw, &stored)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, s := range stored {
+		if s.Type != FieldHidden {
+			continue
+		}
+
+		stored[i].Secret, err = m.rewrap(s.Secret, userID, loginID, fieldAD(s.Name))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(stored)
+}
@@ -0,0 +1,64 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/robihdy/passman/internal/validator"
+)
+
+func TestKeepHiddenValues(t *testing.T) {
+	previous := []Field{
+		{ID: "a", Name: "pin", Type: FieldHidden, Value: "1234"},
+		{ID: "b", Name: "answer", Type: FieldHidden, Value: "blue"},
+		{ID: "c", Name: "account", Type: FieldText, Value: "42"},
+	}
+
+	fields := []Field{
+		{ID: "a", Name: "card pin", Type: FieldHidden, Masked: true},
+		{ID: "b", Name: "answer", Type: FieldHidden},
+		{Name: "new", Type: FieldHidden, Value: "secret"},
+	}
+
+	v := validator.New()
+	KeepHiddenValues(v, fields, previous)
+
+	if !v.Valid() {
+		t.Fatalf("got errors %v", v.Errors)
+	}
+
+	want := []string{"1234", "", "secret"}
+
+	for i, field := range fields {
+		if field.Value != want[i] || field.Masked {
+			t.Errorf("fields[%d] = %+v, want value %q and not masked", i, field, want[i])
+		}
+	}
+}
+
+func TestKeepHiddenValuesErrors(t *testing.T) {
+	previous := []Field{
+		{ID: "a", Name: "pin", Type: FieldHidden, Value: "1234"},
+		{ID: "c", Name: "account", Type: FieldText, Value: "42"},
+	}
+
+	tests := []struct {
+		name  string
+		field Field
+		key   string
+	}{
+		{"unknown id", Field{ID: "x", Name: "pin", Type: FieldHidden, Masked: true}, "fields[0].id"},
+		{"no id", Field{Name: "pin", Type: FieldHidden, Masked: true}, "fields[0].id"},
+		{"not hidden before", Field{ID: "c", Name: "account", Type: FieldHidden, Masked: true}, "fields[0].id"},
+		{"not hidden now", Field{ID: "a", Name: "pin", Type: FieldText, Masked: true}, "fields[0].id"},
+		{"masked with a value", Field{ID: "a", Name: "pin", Type: FieldHidden, Value: "0000", Masked: true}, "fields[0].value"},
+	}
+
+	for _, tt := range tests {
+		v := validator.New()
+		KeepHiddenValues(v, []Field{tt.field}, previous)
+
+		if _, ok := v.Errors[tt.key]; !ok {
+			t.Errorf("%s: got errors %v, want one for %q", tt.name, v.Errors, tt.key)
+		}
+	}
+}
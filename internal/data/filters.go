@@ -1,6 +1,10 @@
 package data
 
-import "github.com/robihdy/passman/internal/validator"
+import (
+	"strings"
+
+	"github.com/robihdy/passman/internal/validator"
+)
 
 type Filters struct {
 	Page         int
@@ -19,3 +23,66 @@ func ValidateFilters(v *validator.Validator, f Filters) {
 	// Check that the sort parameter matches a value in the safelist.
 	v.Check(validator.In(f.Sort, f.SortSafelist...), "sort", "invalid sort value")
 }
+
+// sortExpressions maps the sort values that don't name a column onto what is
+// sorted by instead. Logins that have never been used sort as the least
+// recently used.
+var sortExpressions = map[string]string{
+	"last_used": "COALESCE(last_used_at, '-infinity')",
+}
+
+// sortColumn returns the column to sort by. The sort value has already been
+// checked against the safelist, so anything else is a bug.
+func (f Filters) sortColumn() string {
+	for _, safeValue := range f.SortSafelist {
+		if f.Sort == safeValue {
+			column := strings.TrimPrefix(f.Sort, "-")
+
+			if expression, ok := sortExpressions[column]; ok {
+				return expression
+			}
+
+			return column
+		}
+	}
+
+	panic("unsafe sort parameter: " + f.Sort)
+}
+
+func (f Filters) sortDirection() string {
+	if strings.HasPrefix(f.Sort, "-") {
+		return "DESC"
+	}
+
+	return "ASC"
+}
+
+func (f Filters) limit() int {
+	return f.PageSize
+}
+
+func (f Filters) offset() int {
+	return (f.Page - 1) * f.PageSize
+}
+
+type Metadata struct {
+	CurrentPage  int `json:"current_page,omitempty"`
+	PageSize     int `json:"page_size,omitempty"`
+	FirstPage    int `json:"first_page,omitempty"`
+	LastPage     int `json:"last_page,omitempty"`
+	TotalRecords int `json:"total_records,omitempty"`
+}
+
+func calculateMetadata(totalRecords, page, pageSize int) Metadata {
+	if totalRecords == 0 {
+		return Metadata{}
+	}
+
+	return Metadata{
+		CurrentPage:  page,
+		PageSize:     pageSize,
+		FirstPage:    1,
+		LastPage:     (totalRecords + pageSize - 1) / pageSize,
+		TotalRecords: totalRecords,
+	}
+}
@@ -0,0 +1,383 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/robihdy/passman/internal/validator"
+	"gopkg.in/guregu/null.v4"
+)
+
+var (
+	ErrDuplicateFolder = errors.New("duplicate folder")
+	ErrFolderCycle     = errors.New("folder cycle")
+)
+
+// What happens to the logins and subfolders of a folder being deleted.
+const (
+	FolderContentsMove  = "move"
+	FolderContentsTrash = "trash"
+)
+
+// Folder is a user-owned container for logins. Folders nest through ParentID,
+// and Path spells out the chain of names from the top, like "infra/aws/prod".
+type Folder struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	ParentID  null.Int  `json:"parent_id"`
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	Version   int32     `json:"version"`
+}
+
+func ValidateFolder(v *validator.Validator, folder *Folder) {
+	v.Check(strings.TrimSpace(folder.Name) != "", "name", "must be provided")
+	v.Check(len(folder.Name) <= 255, "name", "must not be more than 255 bytes long")
+	v.Check(!strings.Contains(folder.Name, "/"), "name", "must not contain a slash")
+	v.Check(!folder.ParentID.Valid || folder.ParentID.Int64 != folder.ID, "parent_id", "must not be the folder itself")
+}
+
+type FolderModel struct {
+	DB *sql.DB
+
+	// Revisions is applied to the logins a deleted folder's contents are
+	// moved or trashed with, like on any other update of theirs.
+	Revisions RevisionPolicy
+}
+
+// folderTree is a recursive CTE producing every folder of user $1 with its
+// full path.
+const folderTree = `
+        WITH RECURSIVE tree AS (
+            SELECT id, created_at, parent_id, name, version, name AS path
+            FROM folders
+            WHERE user_id = $1 AND parent_id IS NULL
+            UNION ALL
+            SELECT f.id, f.created_at, f.parent_id, f.name, f.version, t.path || '/' || f.name
+            FROM folders f
+            INNER JOIN tree t ON f.parent_id = t.id
+        )`
+
+// folderSubtree is a recursive CTE producing the IDs of folder $2 of user $1
+// and of every folder below it.
+const folderSubtree = `
+        WITH RECURSIVE subtree AS (
+            SELECT id FROM folders WHERE id = $2 AND user_id = $1
+            UNION ALL
+            SELECT f.id FROM folders f INNER JOIN subtree s ON f.parent_id = s.id
+        )`
+
+func (m FolderModel) Insert(folder *Folder, userID int64) error {
+	query := `
+        INSERT INTO folders (user_id, parent_id, name)
+        VALUES ($1, $2, $3)
+        RETURNING id, created_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID, folder.ParentID, folder.Name).Scan(&folder.ID, &folder.CreatedAt, &folder.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "folders_user_id_parent_id_name_idx"`:
+			return ErrDuplicateFolder
+		default:
+			return err
+		}
+	}
+
+	return m.setPath(folder, userID)
+}
+
+// setPath fills in the path of a folder that has just been written.
+func (m FolderModel) setPath(folder *Folder, userID int64) error {
+	stored, err := m.Get(folder.ID, userID)
+	if err != nil {
+		return err
+	}
+
+	folder.Path = stored.Path
+
+	return nil
+}
+
+func (m FolderModel) Get(id, userID int64) (*Folder, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.get(ctx, m.DB, id, userID)
+}
+
+// GetTx is Get as part of the caller's transaction. The folder's row is
+// locked against changes, so it can't be moved or deleted, until the
+// transaction ends.
+func (m FolderModel) GetTx(ctx context.Context, tx *sql.Tx, id, userID int64) (*Folder, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	// A recursive query can't lock rows itself.
+	_, err := tx.ExecContext(ctx, `SELECT id FROM folders WHERE id = $1 AND user_id = $2 FOR SHARE`, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.get(ctx, tx, id, userID)
+}
+
+func (m FolderModel) get(ctx context.Context, q queryer, id, userID int64) (*Folder, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := folderTree + `
+        SELECT id, created_at, parent_id, name, path, version
+        FROM tree
+        WHERE id = $2`
+
+	var folder Folder
+
+	err := q.QueryRowContext(ctx, query, userID, id).Scan(
+		&folder.ID,
+		&folder.CreatedAt,
+		&folder.ParentID,
+		&folder.Name,
+		&folder.Path,
+		&folder.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &folder, nil
+}
+
+// GetAllForUser returns every folder of the user, ordered by path so that
+// each folder comes straight after its parent.
+func (m FolderModel) GetAllForUser(userID int64) ([]*Folder, error) {
+	query := folderTree + `
+        SELECT id, created_at, parent_id, name, path, version
+        FROM tree
+        ORDER BY path`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	folders := []*Folder{}
+
+	for rows.Next() {
+		var folder Folder
+
+		err := rows.Scan(
+			&folder.ID,
+			&folder.CreatedAt,
+			&folder.ParentID,
+			&folder.Name,
+			&folder.Path,
+			&folder.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		folders = append(folders, &folder)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return folders, nil
+}
+
+// Update renames and moves a folder. It returns ErrFolderCycle if the new
+// parent is the folder itself or one of its descendants.
+func (m FolderModel) Update(folder *Folder, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if folder.ParentID.Valid {
+		// Lock the user, so two concurrent moves can't each pass the check
+		// and put the folders under one another.
+		_, err = tx.ExecContext(ctx, `SELECT id FROM users WHERE id = $1 FOR UPDATE`, userID)
+		if err != nil {
+			return err
+		}
+
+		var cycle bool
+
+		err = tx.QueryRowContext(ctx, folderSubtree+`
+            SELECT EXISTS (SELECT 1 FROM subtree WHERE id = $3)`, userID, folder.ID, folder.ParentID.Int64).Scan(&cycle)
+		if err != nil {
+			return err
+		}
+
+		if cycle {
+			return ErrFolderCycle
+		}
+	}
+
+	query := `
+        UPDATE folders
+        SET parent_id = $1, name = $2, version = version + 1
+        WHERE id = $3 AND user_id = $4 AND version = $5
+        RETURNING version`
+
+	args := []interface{}{folder.ParentID, folder.Name, folder.ID, userID, folder.Version}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&folder.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "folders_user_id_parent_id_name_idx"`:
+			return ErrDuplicateFolder
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	return m.setPath(folder, userID)
+}
+
+// Delete removes a folder. With FolderContentsMove its logins and subfolders
+// are moved up to its parent; with FolderContentsTrash every login anywhere
+// below it is moved to the trash and its subfolders are deleted with it.
+func (m FolderModel) Delete(folder *Folder, userID int64, contents string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Moving or trashing the logins gives them a new version, so their
+	// current state is archived like on any other update.
+	var loginIDs []int64
+
+	switch contents {
+	case FolderContentsMove:
+		// Logins already in the trash are left alone; the folder going
+		// takes them out of it through ON DELETE SET NULL.
+		_, err = tx.ExecContext(ctx, archiveLogins+`
+            WHERE folder_id = $1 AND user_id = $2 AND deleted_at IS NULL`, folder.ID, userID)
+		if err != nil {
+			return err
+		}
+
+		loginIDs, err = updateLogins(ctx, tx, `
+            UPDATE logins SET folder_id = $1, version = version + 1
+            WHERE folder_id = $2 AND user_id = $3 AND deleted_at IS NULL
+            RETURNING id`, folder.ParentID, folder.ID, userID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+            UPDATE folders SET parent_id = $1, version = version + 1
+            WHERE parent_id = $2 AND user_id = $3`, folder.ParentID, folder.ID, userID)
+		if err != nil {
+			switch {
+			case err.Error() == `pq: duplicate key value violates unique constraint "folders_user_id_parent_id_name_idx"`:
+				return ErrDuplicateFolder
+			default:
+				return err
+			}
+		}
+	case FolderContentsTrash:
+		_, err = tx.ExecContext(ctx, folderSubtree+archiveLogins+`
+            WHERE user_id = $1 AND folder_id IN (SELECT id FROM subtree)`, userID, folder.ID)
+		if err != nil {
+			return err
+		}
+
+		// Trashed logins are taken out of the folder as well, so restoring
+		// one puts it back at the top level.
+		loginIDs, err = updateLogins(ctx, tx, folderSubtree+`
+            UPDATE logins
+            SET deleted_at = COALESCE(deleted_at, NOW()), folder_id = NULL, version = version + 1
+            WHERE user_id = $1 AND folder_id IN (SELECT id FROM subtree)
+            RETURNING id`, userID, folder.ID)
+		if err != nil {
+			return err
+		}
+	default:
+		return errors.New("unknown folder contents action: " + contents)
+	}
+
+	err = m.Revisions.prune(ctx, tx, loginIDs...)
+	if err != nil {
+		return err
+	}
+
+	// Subfolders go with the folder through ON DELETE CASCADE.
+	result, err := tx.ExecContext(ctx, `
+        DELETE FROM folders
+        WHERE id = $1 AND user_id = $2`, folder.ID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return tx.Commit()
+}
+
+// updateLogins runs an UPDATE of logins that returns their IDs, and returns
+// them.
+func updateLogins(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) ([]int64, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+
+	for rows.Next() {
+		var id int64
+
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
@@ -0,0 +1,315 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/robihdy/passman/internal/validator"
+)
+
+// Item types. Every item in a vault is stored as a row of the logins table;
+// the type says which of the type-specific shapes it carries besides the
+// fields all items share (name, notes, custom fields, folder and tags).
+const (
+	TypeLogin      = "login"
+	TypeSecureNote = "secure_note"
+	TypeCard       = "card"
+	TypeIdentity   = "identity"
+	TypeSSHKey     = "ssh_key"
+	TypeAPIKey     = "api_key"
+)
+
+var ItemTypes = []string{TypeLogin, TypeSecureNote, TypeCard, TypeIdentity, TypeSSHKey, TypeAPIKey}
+
+// SecureNote is free text, such as the multi-line notes that don't fit in a
+// login's password.
+type SecureNote struct {
+	Text string `json:"text"`
+}
+
+type Card struct {
+	Cardholder  string `json:"cardholder"`
+	Brand       string `json:"brand,omitempty"`
+	Number      string `json:"number"`
+	ExpiryMonth int    `json:"expiry_month"`
+	ExpiryYear  int    `json:"expiry_year"`
+	Code        string `json:"code,omitempty"`
+}
+
+type Identity struct {
+	Title      string `json:"title,omitempty"`
+	FirstName  string `json:"first_name,omitempty"`
+	LastName   string `json:"last_name,omitempty"`
+	Email      string `json:"email,omitempty"`
+	Phone      string `json:"phone,omitempty"`
+	Company    string `json:"company,omitempty"`
+	Address    string `json:"address,omitempty"`
+	City       string `json:"city,omitempty"`
+	Region     string `json:"region,omitempty"`
+	PostalCode string `json:"postal_code,omitempty"`
+	Country    string `json:"country,omitempty"`
+}
+
+type SSHKey struct {
+	PrivateKey  string `json:"private_key"`
+	PublicKey   string `json:"public_key,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	Passphrase  string `json:"passphrase,omitempty"`
+}
+
+type APIKey struct {
+	KeyID    string `json:"key_id,omitempty"`
+	Secret   string `json:"secret"`
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+// ItemContent holds the type-specific part of an item. Only the member
+// matching the item's type is set, and the whole of it is encrypted.
+type ItemContent struct {
+	Note     *SecureNote `json:"note,omitempty"`
+	Card     *Card       `json:"card,omitempty"`
+	Identity *Identity   `json:"identity,omitempty"`
+	SSHKey   *SSHKey     `json:"ssh_key,omitempty"`
+	APIKey   *APIKey     `json:"api_key,omitempty"`
+}
+
+const (
+	maxSecureNoteBytes = 64 * 1024
+	maxSSHKeyBytes     = 16 * 1024
+	maxContentBytes    = 1024
+)
+
+// MarshalJSON leaves the username and password out of items other than
+// logins, which never have them, while logins always carry both keys.
+func (l Login) MarshalJSON() ([]byte, error) {
+	// login has Login's fields but not this method.
+	type login Login
+
+	if l.Type == TypeLogin {
+		return json.Marshal((*login)(&l))
+	}
+
+	// The outer fields hide the embedded ones of the same name.
+	return json.Marshal(struct {
+		*login
+		Username string `json:"username,omitempty"`
+		Password string `json:"password,omitempty"`
+	}{(*login)(&l), l.Username, l.Password})
+}
+
+// value returns the member for itemType, and whether it is set.
+func (c *ItemContent) value(itemType string) (interface{}, bool) {
+	switch itemType {
+	case TypeSecureNote:
+		return c.Note, c.Note != nil
+	case TypeCard:
+		return c.Card, c.Card != nil
+	case TypeIdentity:
+		return c.Identity, c.Identity != nil
+	case TypeSSHKey:
+		return c.SSHKey, c.SSHKey != nil
+	case TypeAPIKey:
+		return c.APIKey, c.APIKey != nil
+	default:
+		return nil, false
+	}
+}
+
+// Merge replaces every member of c that is set in other.
+func (c *ItemContent) Merge(other ItemContent) {
+	if other.Note != nil {
+		c.Note = other.Note
+	}
+	if other.Card != nil {
+		c.Card = other.Card
+	}
+	if other.Identity != nil {
+		c.Identity = other.Identity
+	}
+	if other.SSHKey != nil {
+		c.SSHKey = other.SSHKey
+	}
+	if other.APIKey != nil {
+		c.APIKey = other.APIKey
+	}
+}
+
+// contentKey is the JSON name of the content member of an item type.
+func contentKey(itemType string) string {
+	if itemType == TypeSecureNote {
+		return "note"
+	}
+
+	return itemType
+}
+
+func validateItemContent(v *validator.Validator, itemType string, c *ItemContent) {
+	for _, t := range ItemTypes {
+		if _, ok := c.value(t); ok && t != itemType {
+			v.AddError(contentKey(t), "must only be provided for "+t+" items")
+		}
+	}
+
+	if itemType == TypeLogin {
+		return
+	}
+
+	key := contentKey(itemType)
+
+	if _, ok := c.value(itemType); !ok {
+		v.AddError(key, "must be provided")
+		return
+	}
+
+	switch itemType {
+	case TypeSecureNote:
+		v.Check(c.Note.Text != "", "note.text", "must be provided")
+		v.Check(len(c.Note.Text) <= maxSecureNoteBytes, "note.text", "must not be more than 65536 bytes long")
+	case TypeCard:
+		validateCard(v, c.Card)
+	case TypeIdentity:
+		validateIdentity(v, c.Identity)
+	case TypeSSHKey:
+		v.Check(c.SSHKey.PrivateKey != "", "ssh_key.private_key", "must be provided")
+		v.Check(len(c.SSHKey.PrivateKey) <= maxSSHKeyBytes, "ssh_key.private_key", "must not be more than 16384 bytes long")
+		v.Check(strings.HasPrefix(strings.TrimSpace(c.SSHKey.PrivateKey), "-----BEGIN "), "ssh_key.private_key", "must be a PEM encoded private key")
+		v.Check(len(c.SSHKey.PublicKey) <= maxSSHKeyBytes, "ssh_key.public_key", "must not be more than 16384 bytes long")
+		v.Check(len(c.SSHKey.Fingerprint) <= 255, "ssh_key.fingerprint", "must not be more than 255 bytes long")
+		v.Check(len(c.SSHKey.Passphrase) <= 255, "ssh_key.passphrase", "must not be more than 255 bytes long")
+	case TypeAPIKey:
+		v.Check(c.APIKey.Secret != "", "api_key.secret", "must be provided")
+		v.Check(len(c.APIKey.Secret) <= maxContentBytes, "api_key.secret", "must not be more than 1024 bytes long")
+		v.Check(len(c.APIKey.KeyID) <= 255, "api_key.key_id", "must not be more than 255 bytes long")
+		v.Check(len(c.APIKey.Endpoint) <= maxContentBytes, "api_key.endpoint", "must not be more than 1024 bytes long")
+	}
+}
+
+func validateCard(v *validator.Validator, card *Card) {
+	v.Check(card.Cardholder != "", "card.cardholder", "must be provided")
+	v.Check(len(card.Cardholder) <= 255, "card.cardholder", "must not be more than 255 bytes long")
+	v.Check(len(card.Brand) <= 50, "card.brand", "must not be more than 50 bytes long")
+
+	number := strings.ReplaceAll(card.Number, " ", "")
+	v.Check(len(number) >= 12 && len(number) <= 19 && isDigits(number), "card.number", "must be 12 to 19 digits")
+	v.Check(luhnValid(number), "card.number", "is not a valid card number")
+
+	v.Check(card.ExpiryMonth >= 1 && card.ExpiryMonth <= 12, "card.expiry_month", "must be between 1 and 12")
+	v.Check(card.ExpiryYear >= 2000 && card.ExpiryYear <= 2099, "card.expiry_year", "must be between 2000 and 2099")
+
+	v.Check(card.Code == "" || (len(card.Code) >= 3 && len(card.Code) <= 4 && isDigits(card.Code)), "card.code", "must be 3 or 4 digits")
+}
+
+func validateIdentity(v *validator.Validator, identity *Identity) {
+	v.Check(*identity != Identity{}, "identity", "must not be empty")
+	v.Check(identity.Email == "" || validator.Matches(identity.Email, validator.EmailRX), "identity.email", "must be a valid email address")
+
+	for key, value := range map[string]string{
+		"title":       identity.Title,
+		"first_name":  identity.FirstName,
+		"last_name":   identity.LastName,
+		"email":       identity.Email,
+		"phone":       identity.Phone,
+		"company":     identity.Company,
+		"address":     identity.Address,
+		"city":        identity.City,
+		"region":      identity.Region,
+		"postal_code": identity.PostalCode,
+		"country":     identity.Country,
+	} {
+		v.Check(len(value) <= 255, "identity."+key, "must not be more than 255 bytes long")
+	}
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return s != ""
+}
+
+// luhnValid reports whether a string of digits passes the Luhn checksum that
+// every payment card number carries.
+func luhnValid(number string) bool {
+	if !isDigits(number) {
+		return false
+	}
+
+	sum := 0
+	double := false
+
+	for i := len(number) - 1; i >= 0; i-- {
+		d := int(number[i] - '0')
+
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+
+		sum += d
+		double = !double
+	}
+
+	return sum%10 == 0
+}
+
+// sealContent encrypts the type-specific content of an item. Logins have
+// none, and are stored with a NULL content column.
+func (m LoginModel) sealContent(login *Login, user *User) ([]byte, error) {
+	value, ok := login.ItemContent.value(login.Type)
+	if !ok {
+		return nil, nil
+	}
+
+	plaintext, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.seal(string(plaintext), user, login.ID, "content")
+}
+
+// openContent decrypts content sealed by sealContent.
+func (m LoginModel) openContent(stored []byte, itemType string, user *User, loginID int64) (ItemContent, error) {
+	var content ItemContent
+
+	if stored == nil {
+		return content, nil
+	}
+
+	plaintext, err := m.open(stored, schemeUserEnvelope, user, loginID, "content")
+	if err != nil {
+		return content, err
+	}
+
+	var dst interface{}
+
+	switch itemType {
+	case TypeSecureNote:
+		content.Note = &SecureNote{}
+		dst = content.Note
+	case TypeCard:
+		content.Card = &Card{}
+		dst = content.Card
+	case TypeIdentity:
+		content.Identity = &Identity{}
+		dst = content.Identity
+	case TypeSSHKey:
+		content.SSHKey = &SSHKey{}
+		dst = content.SSHKey
+	case TypeAPIKey:
+		content.APIKey = &APIKey{}
+		dst = content.APIKey
+	default:
+		return content, fmt.Errorf("login %d: content stored for item type %q", loginID, itemType)
+	}
+
+	err = json.Unmarshal([]byte(plaintext), dst)
+
+	return content, err
+}
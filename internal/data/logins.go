@@ -4,183 +4,1322 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
 	"time"
+	"unicode"
 
+	"github.com/lib/pq"
+	"github.com/robihdy/passman/internal/blob"
+	"github.com/robihdy/passman/internal/encryption"
+	"github.com/robihdy/passman/internal/totp"
 	"github.com/robihdy/passman/internal/validator"
 	"gopkg.in/guregu/null.v4"
 )
 
+// Login is an item in a user's vault. The name predates the other item types:
+// besides logins it holds secure notes, cards, identities and keys, told
+// apart by Type.
 type Login struct {
-	ID        int64       `json:"id"`
-	CreatedAt time.Time   `json:"created_at"`
-	Name      string      `json:"name"`
-	Username  string      `json:"username"`
-	Password  string      `json:"password"`
-	Website   null.String `json:"website"`
-	Version   int32       `json:"version"`
+	ID                int64           `json:"id"`
+	CreatedAt         time.Time       `json:"created_at"`
+	Mode              string          `json:"mode"`
+	Type              string          `json:"type"`
+	Name              string          `json:"name"`
+	Username          string          `json:"username"`
+	Password          string          `json:"password"`
+	PasswordMasked    bool            `json:"password_masked,omitempty"`
+	Website           null.String     `json:"website"`
+	URIs              []URI           `json:"uris"`
+	TOTP              string          `json:"totp,omitempty"`
+	Notes             string          `json:"notes"`
+	Fields            []Field         `json:"fields"`
+	FolderID          null.Int        `json:"folder_id"`
+	Tags              []string        `json:"tags"`
+	Favorite          bool            `json:"favorite"`
+	LastUsedAt        *time.Time      `json:"last_used_at"`
+	UseCount          int             `json:"use_count"`
+	Rotation          *RotationPolicy `json:"rotation"`
+	PasswordChangedAt time.Time       `json:"password_changed_at"`
+	RotationDueAt     *time.Time      `json:"rotation_due_at,omitempty"`
+	Overdue           bool            `json:"overdue"`
+	Item              *SealedItem     `json:"item,omitempty"`
+	Revision          int32           `json:"revision,omitempty"`
+	Version           int32           `json:"version"`
+	DeletedAt         *time.Time      `json:"deleted_at,omitempty"`
+	MergedIntoID      *int64          `json:"merged_into_id,omitempty"`
+	UserID            int64           `json:"-"`
+
+	// storedPassword is the password as last read or written, so an update
+	// can tell whether it changes.
+	storedPassword string
+
+	ItemContent
 }
 
 func ValidateLogin(v *validator.Validator, l *Login) {
+	v.Check(validator.In(l.Mode, ModeStandard, ModeZeroKnowledge), "mode", "must be standard or zero_knowledge")
+	v.Check(validator.In(l.Type, ItemTypes...), "type", "must be one of "+strings.Join(ItemTypes, ", "))
+
+	if l.Mode == ModeZeroKnowledge {
+		validateZeroKnowledgeLogin(v, l)
+		return
+	}
+
+	v.Check(l.Item == nil, "item", "must only be provided for zero_knowledge logins")
+	v.Check(l.Revision == 0, "revision", "must only be provided for zero_knowledge logins")
+
 	v.Check(l.Name != "", "name", "must be provided")
 	v.Check(len(l.Name) <= 255, "name", "must not be more than 255 bytes long")
 
-	v.Check(l.Username != "", "username", "must be provided")
-	v.Check(len(l.Username) <= 255, "username", "must not be more than 255 bytes long")
+	if l.Type == TypeLogin {
+		v.Check(l.Username != "", "username", "must be provided")
+		v.Check(len(l.Username) <= 255, "username", "must not be more than 255 bytes long")
+
+		v.Check(l.Password != "", "password", "must be provided")
+		v.Check(len(l.Password) <= 255, "password", "must not be more than 255 bytes long")
+		v.Check(len(l.Password) >= 8, "password", "must be more than or equal to 8 bytes long")
+
+		if l.TOTP != "" {
+			_, err := totp.Parse(l.TOTP)
+			v.Check(err == nil, "totp", "must be an otpauth:// URI or a base32 secret")
+			v.Check(len(l.TOTP) <= 1024, "totp", "must not be more than 1024 bytes long")
+		}
+
+		validateURIs(v, l.URIs)
+	} else {
+		v.Check(l.Username == "", "username", "must only be provided for login items")
+		v.Check(l.Password == "", "password", "must only be provided for login items")
+		v.Check(len(l.URIs) == 0, "uris", "must only be provided for login items")
+		v.Check(l.TOTP == "", "totp", "must only be provided for login items")
+	}
+
+	validateItemContent(v, l.Type, &l.ItemContent)
+
+	v.Check(len(l.Notes) <= 10_000, "notes", "must not be more than 10000 bytes long")
+
+	validateFields(v, l.Fields)
+
+	validateTags(v, l.Tags)
+
+	validateRotation(v, l)
+}
+
+// validateZeroKnowledgeLogin checks the envelope of a client-encrypted login.
+// The login's content lives inside the sealed item, so none of the content
+// fields may be sent in plaintext alongside it. Only what organizes it, such
+// as its folder and tags, is visible to the server.
+func validateZeroKnowledgeLogin(v *validator.Validator, l *Login) {
+	ValidateSealedItem(v, l.Item)
+	validateTags(v, l.Tags)
+
+	v.Check(l.Revision > 0, "revision", "must be greater than zero")
+
+	v.Check(l.Name == "", "name", "must not be provided for zero_knowledge logins")
+	v.Check(l.Username == "", "username", "must not be provided for zero_knowledge logins")
+	v.Check(l.Password == "", "password", "must not be provided for zero_knowledge logins")
+	v.Check(len(l.URIs) == 0, "uris", "must not be provided for zero_knowledge logins")
+	v.Check(l.TOTP == "", "totp", "must not be provided for zero_knowledge logins")
+	v.Check(l.Notes == "", "notes", "must not be provided for zero_knowledge logins")
+	v.Check(len(l.Fields) == 0, "fields", "must not be provided for zero_knowledge logins")
+	v.Check(l.Rotation == nil, "rotation", "must not be provided for zero_knowledge logins")
 
-	v.Check(l.Password != "", "password", "must be provided")
-	v.Check(len(l.Password) <= 255, "password", "must not be more than 255 bytes long")
-	v.Check(len(l.Password) >= 8, "password", "must be more than or equal to 8 bytes long")
+	if _, ok := l.ItemContent.value(l.Type); ok {
+		v.AddError(contentKey(l.Type), "must not be provided for zero_knowledge logins")
+	}
 }
 
+// Encryption schemes recorded in logins.encryption_scheme. Secret fields of
+// logins written today use schemeUserEnvelope: they are sealed with the
+// owner's data encryption key and the result is sealed again with the server
+// key ring. The older schemes are only ever read, and are upgraded by
+// Reencrypt and SealWithDataKey.
+const (
+	schemePlaintext    = 0
+	schemeLegacy       = 1
+	schemeEnvelope     = 2
+	schemeUserEnvelope = 3
+)
+
 type LoginModel struct {
-	DB *sql.DB
+	DB        *sql.DB
+	Keys      *encryption.KeyRing
+	Blobs     blob.Store
+	Revisions RevisionPolicy
 }
 
-func (m LoginModel) Insert(login *Login, userID int64) error {
-	query := `
-        INSERT INTO logins (name, username, password, website, user_id) 
-        VALUES ($1, $2, $3, $4, $5)
-        RETURNING id, created_at, version`
+// loginAD returns the additional data that binds a sealed field to the login
+// and user it belongs to, so a ciphertext copied into another row, another
+// user's vault or another column fails to decrypt.
+func loginAD(userID, loginID int64, field string) []byte {
+	return []byte(fmt.Sprintf("logins:%d:%d:%s", userID, loginID, field))
+}
+
+// seal encrypts a secret field before it is written to the database.
+func (m LoginModel) seal(plaintext string, user *User, loginID int64, field string) ([]byte, error) {
+	dataKey, err := user.dataKey()
+	if err != nil {
+		return nil, err
+	}
 
-	args := []interface{}{login.Name, login.Username, login.Password, login.Website, userID}
+	ad := loginAD(user.ID, loginID, field)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	inner, err := dataKey.Encrypt([]byte(plaintext), ad)
+	if err != nil {
+		return nil, err
+	}
 
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&login.ID, &login.CreatedAt, &login.Version)
+	return m.Keys.Encrypt(inner, ad)
 }
 
-func (m LoginModel) Get(id, userID int64) (*Login, error) {
-	if id < 1 {
-		return nil, ErrRecordNotFound
+// open decrypts a secret field read from the database. Rows written before
+// the current scheme was introduced are still readable until they have been
+// upgraded.
+func (m LoginModel) open(stored []byte, scheme int, user *User, loginID int64, field string) (string, error) {
+	ad := loginAD(user.ID, loginID, field)
+
+	plaintext, err := m.unwrap(stored, scheme, ad)
+	if err == nil && scheme == schemeUserEnvelope {
+		var dataKey *encryption.Key
+
+		dataKey, err = user.dataKey()
+		if err == nil {
+			plaintext, err = dataKey.Decrypt(plaintext, ad)
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("login %d: %s: %w", loginID, field, err)
 	}
 
-	query := `
-        SELECT id, created_at, name, username, password, website, version
-        FROM logins
-        WHERE id = $1 AND user_id = $2`
+	return string(plaintext), nil
+}
 
-	var login Login
+// sealOptional seals a secret field that may be left empty, which is stored
+// as NULL.
+func (m LoginModel) sealOptional(plaintext string, user *User, loginID int64, field string) ([]byte, error) {
+	if plaintext == "" {
+		return nil, nil
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	return m.seal(plaintext, user, loginID, field)
+}
+
+// openOptional opens a field sealed by sealOptional.
+func (m LoginModel) openOptional(stored []byte, user *User, loginID int64, field string) (string, error) {
+	if stored == nil {
+		return "", nil
+	}
+
+	return m.open(stored, schemeUserEnvelope, user, loginID, field)
+}
+
+// unwrap removes the server key ring layer from a stored field.
+func (m LoginModel) unwrap(stored []byte, scheme int, ad []byte) ([]byte, error) {
+	switch scheme {
+	case schemePlaintext:
+		return stored, nil
+	case schemeLegacy:
+		return m.Keys.DecryptLegacy(stored)
+	default:
+		return m.Keys.Decrypt(stored, ad)
+	}
+}
+
+// rewrap re-encrypts the server key ring layer of a field sealed with
+// schemeUserEnvelope, for Reencrypt. Optional fields that are NULL stay NULL.
+func (m LoginModel) rewrap(stored []byte, userID, loginID int64, field string) ([]byte, error) {
+	if stored == nil {
+		return nil, nil
+	}
+
+	ad := loginAD(userID, loginID, field)
+
+	inner, err := m.unwrap(stored, schemeUserEnvelope, ad)
+	if err != nil {
+		return nil, fmt.Errorf("login %d: %s: %w", loginID, field, err)
+	}
+
+	return m.Keys.Encrypt(inner, ad)
+}
+
+// loginColumns are the columns scanLogin expects, in order.
+const loginColumns = `id, created_at, mode, type, name, username, password, encryption_scheme, website, uris, totp, content,
+        notes, sealed_notes, fields, folder_id,
+        ARRAY(SELECT tags.name FROM logins_tags INNER JOIN tags ON tags.id = logins_tags.tag_id
+            WHERE logins_tags.login_id = logins.id ORDER BY tags.name),
+        favorite, last_used_at, use_count, rotation_interval_days, rotation_expires_at, password_changed_at,
+        sealed_item, revision, version, deleted_at, merged_into_id, user_id`
 
-	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanLogin reads a row selected with loginColumns and decrypts it for user.
+func (m LoginModel) scanLogin(row rowScanner, user *User) (*Login, error) {
+	var (
+		login    Login
+		password []byte
+		scheme   int
+		uris     []byte
+		totpSeed []byte
+		content  []byte
+		notes    string
+		sealed   []byte
+		fields   []byte
+		interval sql.NullInt32
+		expires  *time.Time
+	)
+
+	err := row.Scan(
 		&login.ID,
 		&login.CreatedAt,
+		&login.Mode,
+		&login.Type,
 		&login.Name,
 		&login.Username,
-		&login.Password,
+		&password,
+		&scheme,
 		&login.Website,
+		&uris,
+		&totpSeed,
+		&content,
+		&notes,
+		&sealed,
+		&fields,
+		&login.FolderID,
+		pq.Array(&login.Tags),
+		&login.Favorite,
+		&login.LastUsedAt,
+		&login.UseCount,
+		&interval,
+		&expires,
+		&login.PasswordChangedAt,
+		&login.Item,
+		&login.Revision,
 		&login.Version,
+		&login.DeletedAt,
+		&login.MergedIntoID,
+		&login.UserID,
 	)
+	if err != nil {
+		return nil, err
+	}
 
+	login.URIs, err = unmarshalURIs(uris)
 	if err != nil {
-		switch {
-		case errors.Is(err, sql.ErrNoRows):
-			return nil, ErrRecordNotFound
-		default:
+		return nil, fmt.Errorf("login %d: uris: %w", login.ID, err)
+	}
+
+	login.Rotation = rotationFromColumns(interval, expires)
+	login.setRotationDue(time.Now())
+
+	if login.Mode == ModeStandard {
+		login.Password, err = m.open(password, scheme, user, login.ID, "password")
+		if err != nil {
 			return nil, err
 		}
+
+		login.storedPassword = login.Password
+	}
+
+	login.TOTP, err = m.openOptional(totpSeed, user, login.ID, "totp")
+	if err != nil {
+		return nil, err
+	}
+
+	login.ItemContent, err = m.openContent(content, login.Type, user, login.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	login.Notes, err = m.openNotes(notes, sealed, user, login.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	login.Fields, err = m.openFields(fields, user, login.ID)
+	if err != nil {
+		return nil, err
 	}
 
 	return &login, nil
 }
 
-func (m LoginModel) Update(login *Login) error {
+// openNotes returns the notes of a login or revision. Notes are sealed into
+// sealed_notes; the plaintext notes column only holds notes written before
+// they were, until SealNotes gets to them.
+func (m LoginModel) openNotes(plaintext string, sealed []byte, user *User, loginID int64) (string, error) {
+	if sealed == nil {
+		return plaintext, nil
+	}
+
+	return m.openOptional(sealed, user, loginID, "notes")
+}
+
+// sealPassword encrypts the password of a standard login. Zero-knowledge
+// logins have nothing for the server to encrypt.
+func (m LoginModel) sealPassword(login *Login, user *User) ([]byte, int, error) {
+	if login.Mode == ModeZeroKnowledge {
+		return []byte{}, schemePlaintext, nil
+	}
+
+	password, err := m.seal(login.Password, user, login.ID, "password")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return password, schemeUserEnvelope, nil
+}
+
+// Insert stores a new login. It fails with ErrLoginQuota if the user already
+// has maxLogins logins outside the trash.
+func (m LoginModel) Insert(login *Login, user *User, maxLogins int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = m.CheckQuotaTx(ctx, tx, user.ID, 1, maxLogins)
+	if err != nil {
+		return err
+	}
+
+	err = m.InsertTx(ctx, tx, login, user)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// InsertTx is Insert as part of the caller's transaction.
+func (m LoginModel) InsertTx(ctx context.Context, tx *sql.Tx, login *Login, user *User) error {
+	// The ID is allocated up front because it is bound into the ciphertext.
+	err := tx.QueryRowContext(ctx, `SELECT nextval(pg_get_serial_sequence('logins', 'id'))`).Scan(&login.ID)
+	if err != nil {
+		return err
+	}
+
+	login.UserID = user.ID
+
+	password, scheme, err := m.sealPassword(login, user)
+	if err != nil {
+		return err
+	}
+
+	totpSeed, err := m.sealOptional(login.TOTP, user, login.ID, "totp")
+	if err != nil {
+		return err
+	}
+
+	content, err := m.sealContent(login, user)
+	if err != nil {
+		return err
+	}
+
+	notes, err := m.sealOptional(login.Notes, user, login.ID, "notes")
+	if err != nil {
+		return err
+	}
+
+	fields, err := m.sealFields(login, user)
+	if err != nil {
+		return err
+	}
+
+	login.Website = primaryURI(login.URIs)
+
+	uris, err := marshalURIs(login.URIs)
+	if err != nil {
+		return err
+	}
+
+	interval, expires := rotationColumns(login.Rotation)
+
 	query := `
-        UPDATE logins 
-        SET name = $1, username = $2, password = $3, website = $4, version = version + 1
-        WHERE id = $5
-        RETURNING version`
+        INSERT INTO logins (id, mode, type, name, username, password, website, uris, totp, content, sealed_notes, fields,
+            folder_id, favorite, rotation_interval_days, rotation_expires_at, sealed_item, revision, user_id,
+            encryption_scheme, key_id)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21)
+        RETURNING created_at, version, password_changed_at`
 
 	args := []interface{}{
+		login.ID,
+		login.Mode,
+		login.Type,
 		login.Name,
 		login.Username,
-		login.Password,
+		password,
 		login.Website,
-		login.ID,
+		uris,
+		totpSeed,
+		content,
+		notes,
+		fields,
+		login.FolderID,
+		login.Favorite,
+		interval,
+		expires,
+		login.Item,
+		login.Revision,
+		user.ID,
+		scheme,
+		m.Keys.ActiveID(),
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&login.CreatedAt, &login.Version, &login.PasswordChangedAt)
+	if err != nil {
+		return err
+	}
+
+	login.storedPassword = login.Password
+	login.setRotationDue(time.Now())
+
+	return setTags(ctx, tx, login.ID, user.ID, login.Tags)
+}
+
+func (m LoginModel) Get(id int64, user *User) (*Login, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
 	}
 
+	query := `
+        SELECT ` + loginColumns + `
+        FROM logins
+        WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`
+
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	if err := m.DB.QueryRowContext(ctx, query, args...).Scan(&login.Version); err != nil {
-		return err
+	login, err := m.scanLogin(m.DB.QueryRowContext(ctx, query, id, user.ID), user)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
 	}
 
-	return nil
+	return login, nil
 }
 
-func (m LoginModel) Delete(id, userID int64) error {
+// GetTx is Get as part of the caller's transaction. The login's row stays
+// locked until the transaction ends.
+func (m LoginModel) GetTx(ctx context.Context, tx *sql.Tx, id int64, user *User) (*Login, error) {
 	if id < 1 {
-		return ErrRecordNotFound
+		return nil, ErrRecordNotFound
 	}
 
 	query := `
-        DELETE FROM logins
-        WHERE id = $1 AND user_id = $2`
+        SELECT ` + loginColumns + `
+        FROM logins
+        WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+        FOR UPDATE`
+
+	login, err := m.scanLogin(tx.QueryRowContext(ctx, query, id, user.ID), user)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return login, nil
+}
 
+func (m LoginModel) Update(login *Login, user *User) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	rowsAffected, err := result.RowsAffected()
+	err = m.UpdateTx(ctx, tx, login, user)
 	if err != nil {
 		return err
 	}
 
-	if rowsAffected == 0 {
-		return ErrRecordNotFound
+	return tx.Commit()
+}
+
+// UpdateTx is Update as part of the caller's transaction.
+func (m LoginModel) UpdateTx(ctx context.Context, tx *sql.Tx, login *Login, user *User) error {
+	password, scheme, err := m.sealPassword(login, user)
+	if err != nil {
+		return err
 	}
 
-	return nil
-}
+	totpSeed, err := m.sealOptional(login.TOTP, user, login.ID, "totp")
+	if err != nil {
+		return err
+	}
 
-func (m LoginModel) GetByUserID(userID int64) ([]*Login, error) {
-	query := `
-        SELECT id, created_at, name, username, password, website, version
-        FROM logins
-		WHERE user_id = $1
-        ORDER BY id`
+	content, err := m.sealContent(login, user)
+	if err != nil {
+		return err
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	notes, err := m.sealOptional(login.Notes, user, login.ID, "notes")
+	if err != nil {
+		return err
+	}
 
-	rows, err := m.DB.QueryContext(ctx, query, userID)
+	fields, err := m.sealFields(login, user)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
 
-	logins := []*Login{}
+	login.Website = primaryURI(login.URIs)
 
-	for rows.Next() {
-		var login Login
-
-		err := rows.Scan(
-			&login.ID,
-			&login.CreatedAt,
-			&login.Name,
-			&login.Username,
-			&login.Password,
-			&login.Website,
-			&login.Version,
-		)
-		if err != nil {
-			return nil, err
-		}
+	uris, err := marshalURIs(login.URIs)
+	if err != nil {
+		return err
+	}
+
+	interval, expires := rotationColumns(login.Rotation)
+
+	// The ciphertext changes on every write, so whether the password did is
+	// worked out here rather than in SQL.
+	passwordChanged := login.Password != login.storedPassword
+
+	query := `
+        UPDATE logins 
+        SET name = $1, username = $2, password = $3, encryption_scheme = $4, key_id = $5, website = $6,
+            uris = $7, totp = $8, content = $9, notes = '', sealed_notes = $10, fields = $11, folder_id = $12, favorite = $13,
+            rotation_interval_days = $14, rotation_expires_at = $15,
+            password_changed_at = CASE WHEN $16 THEN NOW() ELSE password_changed_at END,
+            sealed_item = $17, revision = $18, version = version + 1
+        WHERE id = $19 AND user_id = $20 AND version = $21 AND deleted_at IS NULL
+        RETURNING version, password_changed_at`
+
+	args := []interface{}{
+		login.Name,
+		login.Username,
+		password,
+		scheme,
+		m.Keys.ActiveID(),
+		login.Website,
+		uris,
+		totpSeed,
+		content,
+		notes,
+		fields,
+		login.FolderID,
+		login.Favorite,
+		interval,
+		expires,
+		passwordChanged,
+		login.Item,
+		login.Revision,
+		login.ID,
+		user.ID,
+		login.Version,
+	}
 
-		logins = append(logins, &login)
+	// Keep the state being replaced in the login's history first. It is
+	// copied exactly as stored, still encrypted.
+	err = m.archive(ctx, tx, login.ID, user.ID, login.Version)
+	if err != nil {
+		return err
 	}
 
-	if err = rows.Err(); err != nil {
-		return nil, err
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&login.Version, &login.PasswordChangedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
 	}
 
-	return logins, nil
+	login.storedPassword = login.Password
+	login.setRotationDue(time.Now())
+
+	err = setTags(ctx, tx, login.ID, user.ID, login.Tags)
+	if err != nil {
+		return err
+	}
+
+	return m.Revisions.prune(ctx, tx, login.ID)
+}
+
+// MaskPassword blanks out the login's password, for responses that list
+// logins rather than hand one out to be used.
+func (l *Login) MaskPassword() {
+	if l.Password != "" {
+		l.Password = ""
+		l.PasswordMasked = true
+	}
+}
+
+// RecordUse notes that the login's password has just been revealed or
+// autofilled. It is bookkeeping rather than an edit, so the version is left
+// alone and no revision is kept.
+func (m LoginModel) RecordUse(login *Login) error {
+	query := `
+        UPDATE logins
+        SET last_used_at = NOW(), use_count = use_count + 1
+        WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+        RETURNING last_used_at, use_count`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, login.ID, login.UserID).Scan(&login.LastUsedAt, &login.UseCount)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete moves a login to the trash. It stays there, hidden from every other
+// query, until it is restored or purged.
+func (m LoginModel) Delete(id, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.delete(ctx, m.DB, id, userID)
+}
+
+// DeleteTx is Delete as part of the caller's transaction.
+func (m LoginModel) DeleteTx(ctx context.Context, tx *sql.Tx, id, userID int64) error {
+	return m.delete(ctx, tx, id, userID)
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func (m LoginModel) delete(ctx context.Context, e execer, id, userID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+        UPDATE logins
+        SET deleted_at = NOW(), version = version + 1
+        WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`
+
+	result, err := e.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// LoginQuery narrows down the logins returned by GetByUserID. Zero values
+// match everything.
+type LoginQuery struct {
+	// Type limits the results to one type of item.
+	Type string
+
+	// Name and Username match case-insensitive substrings.
+	Name     string
+	Username string
+
+	// FolderID limits the results to the logins directly in a folder, or
+	// anywhere below it if Recursive is set.
+	FolderID  int64
+	Recursive bool
+
+	// Tags limits the results to logins carrying any of the tags, or all of
+	// them if AllTags is set.
+	Tags    []string
+	AllTags bool
+
+	// Favorite, if set, limits the results to favorites or to the rest.
+	Favorite null.Bool
+}
+
+// GetByUserID returns a page of the user's logins matching q, along with
+// pagination metadata.
+func (m LoginModel) GetByUserID(user *User, q LoginQuery, filters Filters) ([]*Login, Metadata, error) {
+	query := fmt.Sprintf(`
+        WITH RECURSIVE subtree AS (
+            SELECT id FROM folders WHERE id = $4 AND user_id = $1
+            UNION ALL
+            SELECT f.id FROM folders f INNER JOIN subtree s ON f.parent_id = s.id
+        )
+        SELECT count(*) OVER(), %s
+        FROM logins
+        WHERE user_id = $1 AND deleted_at IS NULL
+        AND (strpos(lower(name), lower($2)) > 0 OR $2 = '')
+        AND (strpos(lower(username), lower($3)) > 0 OR $3 = '')
+        AND ($4 = 0 OR folder_id = $4 OR ($5 AND folder_id IN (SELECT id FROM subtree)))
+        AND (cardinality($6::text[]) = 0 OR (
+            SELECT count(*) FROM logins_tags INNER JOIN tags ON tags.id = logins_tags.tag_id
+            WHERE logins_tags.login_id = logins.id AND tags.name = ANY($6)
+        ) >= CASE WHEN $7 THEN cardinality($6::text[]) ELSE 1 END)
+        AND (type = $8 OR $8 = '')
+        AND (favorite = $9 OR $9 IS NULL)
+        ORDER BY %s %s, id ASC
+        LIMIT $10 OFFSET $11`, loginColumns, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{user.ID, q.Name, q.Username, q.FolderID, q.Recursive, pq.Array(q.Tags), q.AllTags, q.Type,
+		q.Favorite, filters.limit(), filters.offset()}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	logins := []*Login{}
+
+	for rows.Next() {
+		login, err := m.scanLogin(countingScanner{rows, &totalRecords}, user)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		logins = append(logins, login)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return logins, metadata, nil
+}
+
+// Search returns a page of the user's logins matching a free text query,
+// best matches first. Every word of the query must prefix-match a word in the
+// name, username, tags or URIs, so "git" finds both "GitHub" and
+// "gitlab.internal". An empty itemType searches items of every type.
+func (m LoginModel) Search(user *User, q, itemType string, filters Filters) ([]*Login, Metadata, error) {
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(), %s
+        FROM logins
+        WHERE user_id = $1 AND deleted_at IS NULL AND search_vector @@ to_tsquery('simple', $2)
+        AND (type = $3 OR $3 = '')
+        ORDER BY ts_rank(search_vector, to_tsquery('simple', $2)) DESC, id ASC
+        LIMIT $4 OFFSET $5`, loginColumns)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{user.ID, PrefixSearchQuery(q), itemType, filters.limit(), filters.offset()}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	logins := []*Login{}
+
+	for rows.Next() {
+		login, err := m.scanLogin(countingScanner{rows, &totalRecords}, user)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		logins = append(logins, login)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return logins, metadata, nil
+}
+
+// GetByURL returns the user's logins with a URI that matches the page at
+// address, best match first and, among equally good matches, most recently
+// used first. Matching follows each URI's match rule, so it
+// is done here rather than in SQL: only the URIs of candidate logins are
+// read first, and just the logins that match are fetched and decrypted.
+func (m LoginModel) GetByURL(address string, user *User) ([]*Login, error) {
+	target, err := url.Parse(normalizeURL(address))
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+        SELECT id, uris
+        FROM logins
+        WHERE user_id = $1 AND deleted_at IS NULL AND mode = 'standard' AND type = 'login' AND uris <> '[]'`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ranks := make(map[int64]int)
+	var ids []int64
+
+	for rows.Next() {
+		var (
+			id     int64
+			stored []byte
+		)
+
+		if err := rows.Scan(&id, &stored); err != nil {
+			return nil, err
+		}
+
+		uris, err := unmarshalURIs(stored)
+		if err != nil {
+			return nil, fmt.Errorf("login %d: uris: %w", id, err)
+		}
+
+		if rank := matchURIs(uris, target); rank != matchNone {
+			ranks[id] = rank
+			ids = append(ids, id)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	logins := []*Login{}
+
+	if len(ids) == 0 {
+		return logins, nil
+	}
+
+	query = `
+        SELECT ` + loginColumns + `
+        FROM logins
+        WHERE id = ANY($1) AND user_id = $2 AND deleted_at IS NULL
+        ORDER BY last_used_at DESC NULLS LAST, name, id`
+
+	rows, err = m.DB.QueryContext(ctx, query, pq.Array(ids), user.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		login, err := m.scanLogin(rows, user)
+		if err != nil {
+			return nil, err
+		}
+
+		logins = append(logins, login)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(logins, func(i, j int) bool {
+		return ranks[logins[i].ID] > ranks[logins[j].ID]
+	})
+
+	return logins, nil
+}
+
+// PrefixSearchQuery turns free text into a tsquery that requires every word to
+// match as a prefix. Characters with a special meaning in tsquery syntax are
+// dropped, so user input can't change the structure of the query. It returns
+// an empty string if nothing searchable is left.
+func PrefixSearchQuery(q string) string {
+	var terms []string
+
+	for _, word := range strings.Fields(q) {
+		word = strings.Map(func(r rune) rune {
+			if strings.ContainsRune(`&|!():*<>'"\`, r) {
+				return -1
+			}
+			return unicode.ToLower(r)
+		}, word)
+
+		if word != "" {
+			terms = append(terms, "'"+word+"':*")
+		}
+	}
+
+	return strings.Join(terms, " & ")
+}
+
+// countingScanner scans a leading count(*) OVER() column into count and hands
+// the remaining columns to the wrapped scanner's destinations.
+type countingScanner struct {
+	rows  rowScanner
+	count *int
+}
+
+func (s countingScanner) Scan(dest ...interface{}) error {
+	return s.rows.Scan(append([]interface{}{s.count}, dest...)...)
+}
+
+// CheckQuotaTx fails with ErrLoginQuota if the user can't have adding more
+// logins without going past maxLogins. The user's row stays locked until the
+// caller's transaction ends, so concurrent requests can't each see room for
+// the same last login.
+func (m LoginModel) CheckQuotaTx(ctx context.Context, tx *sql.Tx, userID int64, adding, maxLogins int) error {
+	count, err := m.countForUserTx(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+
+	if count+adding > maxLogins {
+		return ErrLoginQuota
+	}
+
+	return nil
+}
+
+// countForUserTx returns how many logins the user has outside the trash, with
+// the user's row locked first.
+func (m LoginModel) countForUserTx(ctx context.Context, tx *sql.Tx, userID int64) (int, error) {
+	_, err := tx.ExecContext(ctx, `SELECT id FROM users WHERE id = $1 FOR UPDATE`, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `
+        SELECT count(*)
+        FROM logins
+        WHERE user_id = $1 AND deleted_at IS NULL`
+
+	var count int
+
+	err = tx.QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
+
+// Reencrypt seals, in place, every login password that is not already sealed
+// with the active key: rows still stored in plaintext or in the legacy
+// unversioned format, and rows sealed with a retired key. This is how keys are
+// rotated; once it has finished the retired key can be dropped from the ring.
+// Only the server key ring layer is touched, so no user's data encryption key
+// is needed. Passwords kept in login revisions and the file keys of
+// attachments are re-encrypted the same way.
+//
+// Rows are processed in batches of batchSize, each in its own transaction, so
+// the server can keep running while it works. It returns the number of rows
+// that were re-encrypted.
+func (m LoginModel) Reencrypt(batchSize int) (int, error) {
+	total := 0
+
+	for _, batch := range []func(int) (int, error){m.reencryptBatch, m.reencryptRevisionBatch, m.reencryptAttachmentBatch} {
+		for {
+			n, err := batch(batchSize)
+			if err != nil {
+				return total, err
+			}
+
+			total += n
+
+			if n < batchSize {
+				break
+			}
+		}
+	}
+
+	return total, nil
+}
+
+func (m LoginModel) reencryptBatch(batchSize int) (int, error) {
+	query := `
+        SELECT id, user_id, password, encryption_scheme, totp, content, sealed_notes, fields
+        FROM logins
+        WHERE mode = 'standard' AND (encryption_scheme < $1 OR key_id IS DISTINCT FROM $2)
+        ORDER BY id
+        LIMIT $3
+        FOR UPDATE SKIP LOCKED`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, schemeEnvelope, m.Keys.ActiveID(), batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	type row struct {
+		id       int64
+		userID   int64
+		password []byte
+		scheme   int
+		totpSeed []byte
+		content  []byte
+		notes    []byte
+		fields   []byte
+	}
+
+	var batch []row
+
+	for rows.Next() {
+		var r row
+
+		err := rows.Scan(&r.id, &r.userID, &r.password, &r.scheme, &r.totpSeed, &r.content, &r.notes, &r.fields)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		batch = append(batch, r)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, r := range batch {
+		ad := loginAD(r.userID, r.id, "password")
+
+		inner, err := m.unwrap(r.password, r.scheme, ad)
+		if err != nil {
+			return 0, fmt.Errorf("login %d: password: %w", r.id, err)
+		}
+
+		password, err := m.Keys.Encrypt(inner, ad)
+		if err != nil {
+			return 0, err
+		}
+
+		totpSeed, err := m.rewrap(r.totpSeed, r.userID, r.id, "totp")
+		if err != nil {
+			return 0, err
+		}
+
+		content, err := m.rewrap(r.content, r.userID, r.id, "content")
+		if err != nil {
+			return 0, err
+		}
+
+		notes, err := m.rewrap(r.notes, r.userID, r.id, "notes")
+		if err != nil {
+			return 0, err
+		}
+
+		fields, err := m.rewrapFields(r.fields, r.userID, r.id)
+		if err != nil {
+			return 0, err
+		}
+
+		scheme := schemeEnvelope
+		if r.scheme == schemeUserEnvelope {
+			scheme = schemeUserEnvelope
+		}
+
+		query := `
+            UPDATE logins
+            SET password = $1, encryption_scheme = $2, totp = $3, content = $4, sealed_notes = $5, fields = $6,
+                key_id = $7
+            WHERE id = $8`
+
+		_, err = tx.ExecContext(ctx, query, password, scheme, totpSeed, content, notes, fields, m.Keys.ActiveID(),
+			r.id)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return len(batch), nil
+}
+
+// SealWithDataKey saves a user that predates per-user data encryption keys
+// and has just been given one, and upgrades every login of theirs, sealing it
+// with the (unlocked) data key. Both happen in one transaction, so the account
+// never has a data key while its logins are still sealed without it.
+func (m LoginModel) SealWithDataKey(user *User) error {
+	query := `
+        SELECT id, password, encryption_scheme
+        FROM logins
+        WHERE user_id = $1 AND mode = 'standard' AND encryption_scheme <> $2
+        FOR UPDATE`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = UserModel{DB: m.DB}.UpdateTx(ctx, tx, user)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx, query, user.ID, schemeUserEnvelope)
+	if err != nil {
+		return err
+	}
+
+	type row struct {
+		id       int64
+		password []byte
+		scheme   int
+	}
+
+	var batch []row
+
+	for rows.Next() {
+		var r row
+
+		err := rows.Scan(&r.id, &r.password, &r.scheme)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+
+		batch = append(batch, r)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, r := range batch {
+		plaintext, err := m.open(r.password, r.scheme, user, r.id, "password")
+		if err != nil {
+			return err
+		}
+
+		password, err := m.seal(plaintext, user, r.id, "password")
+		if err != nil {
+			return err
+		}
+
+		query := `
+            UPDATE logins
+            SET password = $1, encryption_scheme = $2, key_id = $3
+            WHERE id = $4`
+
+		_, err = tx.ExecContext(ctx, query, password, schemeUserEnvelope, m.Keys.ActiveID(), r.id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// SealNotes seals the notes of the user's logins and login revisions that
+// were written while notes were still stored in plaintext. It needs the
+// user's (unlocked) data key, so it is run when they sign in; once their notes
+// are sealed it has nothing to do.
+func (m LoginModel) SealNotes(user *User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	type row struct {
+		loginID int64
+		version int32
+		notes   string
+	}
+
+	// Logins are read with a version of zero, which no revision has.
+	query := `
+        SELECT id, 0, notes
+        FROM logins
+        WHERE user_id = $1 AND notes <> ''
+        UNION ALL
+        SELECT r.login_id, r.version, r.notes
+        FROM login_revisions r
+        INNER JOIN logins l ON l.id = r.login_id
+        WHERE l.user_id = $1 AND r.notes <> ''`
+
+	rows, err := tx.QueryContext(ctx, query, user.ID)
+	if err != nil {
+		return err
+	}
+
+	var batch []row
+
+	for rows.Next() {
+		var r row
+
+		err := rows.Scan(&r.loginID, &r.version, &r.notes)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+
+		batch = append(batch, r)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, r := range batch {
+		notes, err := m.seal(r.notes, user, r.loginID, "notes")
+		if err != nil {
+			return err
+		}
+
+		if r.version == 0 {
+			_, err = tx.ExecContext(ctx, `UPDATE logins SET notes = '', sealed_notes = $1 WHERE id = $2 AND notes = $3`,
+				notes, r.loginID, r.notes)
+		} else {
+			_, err = tx.ExecContext(ctx, `
+                UPDATE login_revisions SET notes = '', sealed_notes = $1
+                WHERE login_id = $2 AND version = $3 AND notes = $4`,
+				notes, r.loginID, r.version, r.notes)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
@@ -3,23 +3,36 @@ package data
 import (
 	"database/sql"
 	"errors"
+
+	"github.com/robihdy/passman/internal/blob"
+	"github.com/robihdy/passman/internal/encryption"
 )
 
 var (
 	ErrRecordNotFound = errors.New("record not found")
 	ErrEditConflict   = errors.New("edit conflict")
+
+	// ErrLoginQuota is returned when creating or restoring a login would take
+	// its owner past the number of logins they may have.
+	ErrLoginQuota = errors.New("login quota exceeded")
 )
 
 type Models struct {
 	Logins      LoginModel
+	Attachments AttachmentModel
+	Folders     FolderModel
+	Tags        TagModel
 	Users       UserModel
 	Tokens      TokenModel
 	Permissions PermissionModel
 }
 
-func NewModels(db *sql.DB) Models {
+func NewModels(db *sql.DB, keys *encryption.KeyRing, blobs blob.Store) Models {
 	return Models{
-		Logins:      LoginModel{DB: db},
+		Logins:      LoginModel{DB: db, Keys: keys, Blobs: blobs},
+		Attachments: AttachmentModel{DB: db, Keys: keys, Blobs: blobs},
+		Folders:     FolderModel{DB: db},
+		Tags:        TagModel{DB: db},
 		Users:       UserModel{DB: db},
 		Tokens:      TokenModel{DB: db},
 		Permissions: PermissionModel{DB: db},
@@ -0,0 +1,398 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"gopkg.in/guregu/null.v4"
+)
+
+// RevisionPolicy controls how much of each login's history is kept. A zero
+// value for either field means no limit of that kind.
+type RevisionPolicy struct {
+	Keep   int
+	MaxAge time.Duration
+}
+
+// LoginRevision is an earlier state of a login, identified by the version the
+// login had while it was in that state.
+type LoginRevision struct {
+	Version    int32       `json:"version"`
+	ReplacedAt time.Time   `json:"replaced_at"`
+	Name       string      `json:"name"`
+	Username   string      `json:"username"`
+	Password   string      `json:"password"`
+	Website    null.String `json:"website"`
+	URIs       []URI       `json:"uris"`
+	TOTP       string      `json:"totp,omitempty"`
+	Notes      string      `json:"notes"`
+	Fields     []Field     `json:"fields"`
+	Item       *SealedItem `json:"item,omitempty"`
+	Revision   int32       `json:"revision,omitempty"`
+
+	ItemContent
+}
+
+// archiveLogins copies the current state of the logins selected by the WHERE
+// clause that follows it into login_revisions.
+const archiveLogins = `
+        INSERT INTO login_revisions (login_id, version, name, username, password, encryption_scheme, key_id,
+            website, uris, totp, content, notes, sealed_notes, fields, sealed_item, revision)
+        SELECT id, version, name, username, password, encryption_scheme, key_id, website, uris, totp, content,
+            notes, sealed_notes, fields, sealed_item, revision
+        FROM logins`
+
+// archive copies the current state of a login into login_revisions. It fails
+// with ErrEditConflict if the login isn't at the expected version.
+func (m LoginModel) archive(ctx context.Context, tx *sql.Tx, loginID, userID int64, version int32) error {
+	query := archiveLogins + `
+        WHERE id = $1 AND user_id = $2 AND version = $3 AND deleted_at IS NULL`
+
+	result, err := tx.ExecContext(ctx, query, loginID, userID, version)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+// prune removes revisions of the logins that fall outside the policy.
+func (p RevisionPolicy) prune(ctx context.Context, tx *sql.Tx, loginIDs ...int64) error {
+	if len(loginIDs) == 0 {
+		return nil
+	}
+
+	if p.Keep > 0 {
+		query := `
+            DELETE FROM login_revisions r
+            WHERE r.login_id = ANY($1) AND r.version NOT IN (
+                SELECT version FROM login_revisions
+                WHERE login_id = r.login_id
+                ORDER BY version DESC
+                LIMIT $2
+            )`
+
+		_, err := tx.ExecContext(ctx, query, pq.Array(loginIDs), p.Keep)
+		if err != nil {
+			return err
+		}
+	}
+
+	if p.MaxAge > 0 {
+		query := `
+            DELETE FROM login_revisions
+            WHERE login_id = ANY($1) AND created_at < $2`
+
+		_, err := tx.ExecContext(ctx, query, pq.Array(loginIDs), time.Now().Add(-p.MaxAge))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PruneRevisions deletes the revisions of every login that are older than the
+// policy's MaxAge. RevisionPolicy.prune only applies the policy to logins as they
+// are updated, so this has to run periodically for logins that never are
+// again.
+func (m LoginModel) PruneRevisions() (int64, error) {
+	if m.Revisions.MaxAge <= 0 {
+		return 0, nil
+	}
+
+	query := `
+        DELETE FROM login_revisions
+        WHERE created_at < $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, time.Now().Add(-m.Revisions.MaxAge))
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+const revisionColumns = `version, created_at, name, username, password, encryption_scheme, website, uris, totp, content,
+        notes, sealed_notes, fields, sealed_item, revision`
+
+func (m LoginModel) scanRevision(row rowScanner, login *Login, user *User) (*LoginRevision, error) {
+	var (
+		revision LoginRevision
+		password []byte
+		scheme   int
+		uris     []byte
+		totpSeed []byte
+		content  []byte
+		notes    string
+		sealed   []byte
+		fields   []byte
+	)
+
+	err := row.Scan(
+		&revision.Version,
+		&revision.ReplacedAt,
+		&revision.Name,
+		&revision.Username,
+		&password,
+		&scheme,
+		&revision.Website,
+		&uris,
+		&totpSeed,
+		&content,
+		&notes,
+		&sealed,
+		&fields,
+		&revision.Item,
+		&revision.Revision,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	revision.URIs, err = unmarshalURIs(uris)
+	if err != nil {
+		return nil, fmt.Errorf("version %d: uris: %w", revision.Version, err)
+	}
+
+	if login.Mode == ModeStandard {
+		revision.Password, err = m.open(password, scheme, user, login.ID, "password")
+		if err != nil {
+			return nil, fmt.Errorf("version %d: %w", revision.Version, err)
+		}
+	}
+
+	revision.TOTP, err = m.openOptional(totpSeed, user, login.ID, "totp")
+	if err != nil {
+		return nil, fmt.Errorf("version %d: %w", revision.Version, err)
+	}
+
+	revision.ItemContent, err = m.openContent(content, login.Type, user, login.ID)
+	if err != nil {
+		return nil, fmt.Errorf("version %d: %w", revision.Version, err)
+	}
+
+	revision.Notes, err = m.openNotes(notes, sealed, user, login.ID)
+	if err != nil {
+		return nil, fmt.Errorf("version %d: %w", revision.Version, err)
+	}
+
+	revision.Fields, err = m.openFields(fields, user, login.ID)
+	if err != nil {
+		return nil, fmt.Errorf("version %d: %w", revision.Version, err)
+	}
+
+	return &revision, nil
+}
+
+// GetRevisions returns the retained history of a login, newest first.
+func (m LoginModel) GetRevisions(login *Login, user *User) ([]*LoginRevision, error) {
+	query := `
+        SELECT ` + revisionColumns + `
+        FROM login_revisions
+        WHERE login_id = $1
+        ORDER BY version DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, login.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*LoginRevision{}
+
+	for rows.Next() {
+		revision, err := m.scanRevision(rows, login, user)
+		if err != nil {
+			return nil, err
+		}
+
+		revisions = append(revisions, revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// GetRevision returns a single earlier version of a login.
+func (m LoginModel) GetRevision(login *Login, version int32, user *User) (*LoginRevision, error) {
+	query := `
+        SELECT ` + revisionColumns + `
+        FROM login_revisions
+        WHERE login_id = $1 AND version = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	revision, err := m.scanRevision(m.DB.QueryRowContext(ctx, query, login.ID, version), login, user)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return revision, nil
+}
+
+// Restore makes an earlier revision the current state of a login. The state
+// it replaces is archived like any other update, so a restore can itself be
+// undone.
+func (m LoginModel) Restore(login *Login, revision *LoginRevision, user *User) error {
+	login.Name = revision.Name
+	login.Username = revision.Username
+	login.Password = revision.Password
+	login.URIs = revision.URIs
+	login.TOTP = revision.TOTP
+	login.ItemContent = revision.ItemContent
+	login.Notes = revision.Notes
+	login.Fields = revision.Fields
+	login.Item = revision.Item
+
+	// Zero-knowledge clients rely on the revision only ever going up.
+	if login.Mode == ModeZeroKnowledge {
+		login.Revision++
+	}
+
+	return m.Update(login, user)
+}
+
+// reencryptRevisionBatch is the login_revisions counterpart of reencryptBatch.
+func (m LoginModel) reencryptRevisionBatch(batchSize int) (int, error) {
+	query := `
+        SELECT r.login_id, r.version, l.user_id, r.password, r.encryption_scheme, r.totp, r.content, r.sealed_notes,
+            r.fields
+        FROM login_revisions r
+        INNER JOIN logins l ON l.id = r.login_id
+        WHERE l.mode = 'standard' AND (r.encryption_scheme < $1 OR r.key_id IS DISTINCT FROM $2)
+        ORDER BY r.login_id, r.version
+        LIMIT $3
+        FOR UPDATE OF r SKIP LOCKED`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, schemeEnvelope, m.Keys.ActiveID(), batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	type row struct {
+		loginID  int64
+		version  int32
+		userID   int64
+		password []byte
+		scheme   int
+		totpSeed []byte
+		content  []byte
+		notes    []byte
+		fields   []byte
+	}
+
+	var batch []row
+
+	for rows.Next() {
+		var r row
+
+		err := rows.Scan(&r.loginID, &r.version, &r.userID, &r.password, &r.scheme, &r.totpSeed, &r.content, &r.notes,
+			&r.fields)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		batch = append(batch, r)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, r := range batch {
+		ad := loginAD(r.userID, r.loginID, "password")
+
+		inner, err := m.unwrap(r.password, r.scheme, ad)
+		if err != nil {
+			return 0, fmt.Errorf("login %d version %d: password: %w", r.loginID, r.version, err)
+		}
+
+		password, err := m.Keys.Encrypt(inner, ad)
+		if err != nil {
+			return 0, err
+		}
+
+		totpSeed, err := m.rewrap(r.totpSeed, r.userID, r.loginID, "totp")
+		if err != nil {
+			return 0, err
+		}
+
+		content, err := m.rewrap(r.content, r.userID, r.loginID, "content")
+		if err != nil {
+			return 0, err
+		}
+
+		notes, err := m.rewrap(r.notes, r.userID, r.loginID, "notes")
+		if err != nil {
+			return 0, err
+		}
+
+		fields, err := m.rewrapFields(r.fields, r.userID, r.loginID)
+		if err != nil {
+			return 0, err
+		}
+
+		scheme := schemeEnvelope
+		if r.scheme == schemeUserEnvelope {
+			scheme = schemeUserEnvelope
+		}
+
+		query := `
+            UPDATE login_revisions
+            SET password = $1, encryption_scheme = $2, totp = $3, content = $4, sealed_notes = $5, fields = $6,
+                key_id = $7
+            WHERE login_id = $8 AND version = $9`
+
+		_, err = tx.ExecContext(ctx, query, password, scheme, totpSeed, content, notes, fields, m.Keys.ActiveID(),
+			r.loginID, r.version)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return len(batch), nil
+}
@@ -0,0 +1,221 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/robihdy/passman/internal/validator"
+)
+
+// RotationPolicy says when the password of a login has to be changed: a
+// number of days after it was last changed, or by a fixed date. Only one of
+// the two is set.
+type RotationPolicy struct {
+	IntervalDays int        `json:"interval_days,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+}
+
+// NormalizeRotation turns a policy with neither field set, which is how a
+// client removes a login's policy, into no policy.
+func NormalizeRotation(policy *RotationPolicy) *RotationPolicy {
+	if policy == nil || (policy.IntervalDays == 0 && policy.ExpiresAt == nil) {
+		return nil
+	}
+
+	return policy
+}
+
+func validateRotation(v *validator.Validator, l *Login) {
+	if l.Rotation == nil {
+		return
+	}
+
+	if l.Type != TypeLogin {
+		v.AddError("rotation", "must only be provided for login items")
+		return
+	}
+
+	v.Check(l.Rotation.IntervalDays == 0 || l.Rotation.ExpiresAt == nil, "rotation", "must have either interval_days or expires_at, not both")
+	v.Check(l.Rotation.IntervalDays >= 0, "rotation.interval_days", "must be greater than zero")
+	v.Check(l.Rotation.IntervalDays <= 3650, "rotation.interval_days", "must not be more than 3650")
+}
+
+// rotationDueAt returns when the login's password has to be changed by, or
+// nil if it has no policy.
+func (l *Login) rotationDueAt() *time.Time {
+	switch {
+	case l.Rotation == nil:
+		return nil
+	case l.Rotation.ExpiresAt != nil:
+		due := *l.Rotation.ExpiresAt
+		return &due
+	default:
+		due := l.PasswordChangedAt.AddDate(0, 0, l.Rotation.IntervalDays)
+		return &due
+	}
+}
+
+// setRotationDue fills in when the login's password is due to be changed and
+// whether that has already passed.
+func (l *Login) setRotationDue(now time.Time) {
+	l.RotationDueAt = l.rotationDueAt()
+	l.Overdue = l.RotationDueAt != nil && !now.Before(*l.RotationDueAt)
+}
+
+// rotationColumns returns what is stored for the policy, NULLs for no policy.
+func rotationColumns(policy *RotationPolicy) (sql.NullInt32, *time.Time) {
+	if policy == nil {
+		return sql.NullInt32{}, nil
+	}
+
+	return sql.NullInt32{Int32: int32(policy.IntervalDays), Valid: policy.IntervalDays > 0}, policy.ExpiresAt
+}
+
+// rotationFromColumns is the reverse of rotationColumns.
+func rotationFromColumns(intervalDays sql.NullInt32, expiresAt *time.Time) *RotationPolicy {
+	if !intervalDays.Valid && expiresAt == nil {
+		return nil
+	}
+
+	return &RotationPolicy{IntervalDays: int(intervalDays.Int32), ExpiresAt: expiresAt}
+}
+
+// rotationDue is the SQL counterpart of rotationDueAt, NULL for logins
+// without a policy.
+const rotationDue = `COALESCE(rotation_expires_at, password_changed_at + rotation_interval_days * INTERVAL '1 day')`
+
+// GetExpiring returns the user's logins whose password has to be changed
+// within the given time, including those already overdue, soonest first.
+func (m LoginModel) GetExpiring(user *User, within time.Duration, itemType string, filters Filters) ([]*Login, Metadata, error) {
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(), %s
+        FROM logins
+        WHERE user_id = $1
+        AND deleted_at IS NULL
+        AND (type = $2 OR $2 = '')
+        AND %s <= NOW() + $3 * INTERVAL '1 second'
+        ORDER BY %s ASC, id ASC
+        LIMIT $4 OFFSET $5`, loginColumns, rotationDue, rotationDue)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, user.ID, itemType, int64(within/time.Second), filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	logins := []*Login{}
+
+	for rows.Next() {
+		login, err := m.scanLogin(countingScanner{rows, &totalRecords}, user)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		logins = append(logins, login)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return logins, metadata, nil
+}
+
+// OverdueLogin is a login whose password is overdue for rotation, with who to
+// tell about it. The name is the only part of the login given out, so no
+// secrets need decrypting to send a reminder.
+type OverdueLogin struct {
+	LoginID   int64     `json:"login_id"`
+	LoginName string    `json:"login_name"`
+	DueAt     time.Time `json:"due_at"`
+	UserID    int64     `json:"user_id"`
+	UserName  string    `json:"user_name"`
+	UserEmail string    `json:"user_email"`
+}
+
+// GetRotationOverdue returns up to limit logins that have gone overdue since
+// their owner was last told about them, longest overdue first. Once a reminder
+// is sent the login is passed over until MarkRotationNotified's time is behind
+// a new due date. One that failed to send is passed over until the backoff
+// set by MarkRotationFailed has passed, so reminders that keep failing don't
+// hold up the rest.
+func (m LoginModel) GetRotationOverdue(limit int) ([]*OverdueLogin, error) {
+	query := fmt.Sprintf(`
+        SELECT logins.id, logins.name, %s, users.id, users.name, users.email
+        FROM logins
+        INNER JOIN users ON users.id = logins.user_id
+        WHERE logins.deleted_at IS NULL
+        AND %s <= NOW()
+        AND (logins.rotation_notified_at IS NULL OR logins.rotation_notified_at < %s)
+        AND (logins.rotation_retry_at IS NULL OR logins.rotation_retry_at <= NOW())
+        ORDER BY %s ASC, logins.id ASC
+        LIMIT $1`, rotationDue, rotationDue, rotationDue, rotationDue)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	overdue := []*OverdueLogin{}
+
+	for rows.Next() {
+		var o OverdueLogin
+
+		err := rows.Scan(&o.LoginID, &o.LoginName, &o.DueAt, &o.UserID, &o.UserName, &o.UserEmail)
+		if err != nil {
+			return nil, err
+		}
+
+		overdue = append(overdue, &o)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return overdue, nil
+}
+
+// MarkRotationNotified records that the owner of a login has been told its
+// password is overdue.
+func (m LoginModel) MarkRotationNotified(loginID int64) error {
+	query := `
+        UPDATE logins
+        SET rotation_notified_at = NOW(), rotation_notify_attempts = 0, rotation_retry_at = NULL
+        WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, loginID)
+	return err
+}
+
+// MarkRotationFailed records that a reminder about a login couldn't be sent.
+// It is tried again after a minute, then after twice as long on each further
+// failure, up to a day.
+func (m LoginModel) MarkRotationFailed(loginID int64) error {
+	query := `
+        UPDATE logins
+        SET rotation_retry_at = NOW() + LEAST(POWER(2, rotation_notify_attempts), 1440) * INTERVAL '1 minute',
+            rotation_notify_attempts = rotation_notify_attempts + 1
+        WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, loginID)
+	return err
+}
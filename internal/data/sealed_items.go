@@ -0,0 +1,82 @@
+package data
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+
+	"github.com/robihdy/passman/internal/validator"
+)
+
+// Login modes. Standard logins are encrypted by the server; zero-knowledge
+// logins are encrypted by the client and the server only ever sees a
+// SealedItem.
+const (
+	ModeStandard      = "standard"
+	ModeZeroKnowledge = "zero_knowledge"
+)
+
+// Algorithms a client may use to seal an item, with their nonce sizes.
+var sealedItemAlgorithms = map[string]int{
+	"A256GCM": 12,
+}
+
+const (
+	SealedItemVersion        = 2
+	MaxSealedItemSize        = 64 * 1024
+	maxSealedItemKeyIDBytes  = 255
+	maxSealedItemItemIDBytes = 255
+)
+
+// SealedItem is the opaque, client-encrypted payload of a zero-knowledge
+// login. Its fields only describe how it was sealed; the server stores it as
+// it was received and can't read what it protects. ItemID is assigned by the
+// client and bound to the ciphertext, so an item can't be passed off as
+// another one.
+type SealedItem struct {
+	Version    int    `json:"version"`
+	Algorithm  string `json:"algorithm"`
+	KeyID      string `json:"key_id"`
+	ItemID     string `json:"item_id,omitempty"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+func ValidateSealedItem(v *validator.Validator, item *SealedItem) {
+	if item == nil {
+		v.AddError("item", "must be provided")
+		return
+	}
+
+	v.Check(item.Version == SealedItemVersion, "item.version", "unsupported version")
+
+	nonceSize, ok := sealedItemAlgorithms[item.Algorithm]
+	v.Check(ok, "item.algorithm", "unsupported algorithm")
+	if ok {
+		v.Check(len(item.Nonce) == nonceSize, "item.nonce", "has the wrong length for the algorithm")
+	}
+
+	v.Check(item.KeyID != "", "item.key_id", "must be provided")
+	v.Check(len(item.KeyID) <= maxSealedItemKeyIDBytes, "item.key_id", "must not be more than 255 bytes long")
+
+	v.Check(item.ItemID != "", "item.item_id", "must be provided")
+	v.Check(len(item.ItemID) <= maxSealedItemItemIDBytes, "item.item_id", "must not be more than 255 bytes long")
+
+	v.Check(len(item.Ciphertext) > 0, "item.ciphertext", "must be provided")
+	v.Check(len(item.Ciphertext) <= MaxSealedItemSize, "item.ciphertext", "must not be more than 65536 bytes long")
+}
+
+// Value stores the item as JSON, leaving the column NULL for logins that
+// don't have one.
+func (item SealedItem) Value() (driver.Value, error) {
+	return json.Marshal(item)
+}
+
+func (item *SealedItem) Scan(src interface{}) error {
+	b, ok := src.([]byte)
+	if !ok {
+		return errors.New("sealed item must be scanned from a byte slice")
+	}
+
+	return json.Unmarshal(b, item)
+}
@@ -0,0 +1,133 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/robihdy/passman/internal/validator"
+)
+
+const (
+	maxTagsPerLogin = 32
+	maxTagBytes     = 64
+)
+
+// Tag is a label the user has put on one or more logins.
+type Tag struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// NormalizeTags trims and lowercases tags and drops empty and repeated ones,
+// so that "Prod" and " prod" are the same tag.
+func NormalizeTags(tags []string) []string {
+	seen := make(map[string]bool)
+	normalized := []string{}
+
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+
+		if tag == "" || seen[tag] {
+			continue
+		}
+
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+
+	return normalized
+}
+
+func validateTags(v *validator.Validator, tags []string) {
+	v.Check(len(tags) <= maxTagsPerLogin, "tags", "must not contain more than 32 tags")
+	v.Check(validator.Unique(tags), "tags", "must not contain duplicate values")
+
+	for _, tag := range tags {
+		v.Check(tag != "", "tags", "must not contain empty values")
+		v.Check(len(tag) <= maxTagBytes, "tags", "must not contain tags more than 64 bytes long")
+		v.Check(!strings.Contains(tag, ","), "tags", "must not contain commas")
+	}
+}
+
+// setTags replaces the tags of a login, creating any tags the user doesn't
+// have yet and dropping those no longer on any of their logins.
+func setTags(ctx context.Context, tx *sql.Tx, loginID, userID int64, tags []string) error {
+	_, err := tx.ExecContext(ctx, `
+        DELETE FROM logins_tags
+        WHERE login_id = $1`, loginID)
+	if err != nil {
+		return err
+	}
+
+	if len(tags) > 0 {
+		_, err = tx.ExecContext(ctx, `
+            INSERT INTO tags (user_id, name)
+            SELECT $1, unnest($2::text[])
+            ON CONFLICT DO NOTHING`, userID, pq.Array(tags))
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+            INSERT INTO logins_tags (login_id, tag_id)
+            SELECT $1, id FROM tags
+            WHERE user_id = $2 AND name = ANY($3)`, loginID, userID, pq.Array(tags))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+        DELETE FROM tags
+        WHERE user_id = $1 AND NOT EXISTS (SELECT 1 FROM logins_tags WHERE tag_id = tags.id)`, userID)
+
+	return err
+}
+
+type TagModel struct {
+	DB *sql.DB
+}
+
+// GetAllForUser returns the user's tags with how many logins carry each,
+// most used first. Logins in the trash aren't counted.
+func (m TagModel) GetAllForUser(userID int64) ([]*Tag, error) {
+	query := `
+        SELECT tags.name, count(*)
+        FROM tags
+        INNER JOIN logins_tags ON logins_tags.tag_id = tags.id
+        INNER JOIN logins ON logins.id = logins_tags.login_id
+        WHERE tags.user_id = $1 AND logins.deleted_at IS NULL
+        GROUP BY tags.name
+        ORDER BY count(*) DESC, tags.name ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []*Tag{}
+
+	for rows.Next() {
+		var tag Tag
+
+		err := rows.Scan(&tag.Name, &tag.Count)
+		if err != nil {
+			return nil, err
+		}
+
+		tags = append(tags, &tag)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
@@ -6,8 +6,10 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/base32"
+	"fmt"
 	"time"
 
+	"github.com/robihdy/passman/internal/encryption"
 	"github.com/robihdy/passman/internal/validator"
 )
 
@@ -21,6 +23,36 @@ type Token struct {
 	UserID    int64     `json:"-"`
 	Expiry    time.Time `json:"expiry"`
 	Scope     string    `json:"-"`
+	DataKey   []byte    `json:"-"`
+}
+
+// The user's data encryption key is stored with each of their tokens, wrapped
+// by a key derived from the token plaintext. Only the token hash is stored, so
+// the key can only be unwrapped by someone presenting the token.
+func sessionKEK(tokenPlaintext string) (*encryption.Key, error) {
+	return encryption.ExpandKey("session", []byte(tokenPlaintext), []byte("passman session data key"))
+}
+
+func sessionAD(userID int64) []byte {
+	return []byte(fmt.Sprintf("tokens:%d:data_key", userID))
+}
+
+func wrapSessionKey(tokenPlaintext string, userID int64, dataKey *encryption.Key) ([]byte, error) {
+	kek, err := sessionKEK(tokenPlaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	return encryption.WrapKey(kek, dataKey, sessionAD(userID))
+}
+
+func unwrapSessionKey(tokenPlaintext string, userID int64, wrapped []byte) (*encryption.Key, error) {
+	kek, err := sessionKEK(tokenPlaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	return encryption.UnwrapKey(kek, dataKeyID, wrapped, sessionAD(userID))
 }
 
 func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error) {
@@ -54,22 +86,32 @@ type TokenModel struct {
 	DB *sql.DB
 }
 
-func (m TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token, error) {
-	token, err := generateToken(userID, ttl, scope)
+// New generates and stores a token for the user. If the user's data
+// encryption key is unlocked it is stored with the token, so that requests
+// authenticated by the token can decrypt the user's logins.
+func (m TokenModel) New(user *User, ttl time.Duration, scope string) (*Token, error) {
+	token, err := generateToken(user.ID, ttl, scope)
 	if err != nil {
 		return nil, err
 	}
 
+	if user.Password.dataKey != nil {
+		token.DataKey, err = wrapSessionKey(token.Plaintext, user.ID, user.Password.dataKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	err = m.Insert(token)
 	return token, err
 }
 
 func (m TokenModel) Insert(token *Token) error {
 	query := `
-        INSERT INTO tokens (hash, user_id, expiry, scope) 
-        VALUES ($1, $2, $3, $4)`
+        INSERT INTO tokens (hash, user_id, expiry, scope, data_key) 
+        VALUES ($1, $2, $3, $4, $5)`
 
-	args := []interface{}{token.Hash, token.UserID, token.Expiry, token.Scope}
+	args := []interface{}{token.Hash, token.UserID, token.Expiry, token.Scope, token.DataKey}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -0,0 +1,210 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// GetTrash returns a page of the user's deleted logins along with pagination
+// metadata.
+func (m LoginModel) GetTrash(user *User, filters Filters) ([]*Login, Metadata, error) {
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(), %s
+        FROM logins
+        WHERE user_id = $1 AND deleted_at IS NOT NULL
+        ORDER BY %s %s, id ASC
+        LIMIT $2 OFFSET $3`, loginColumns, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, user.ID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	logins := []*Login{}
+
+	for rows.Next() {
+		login, err := m.scanLogin(countingScanner{rows, &totalRecords}, user)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		logins = append(logins, login)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return logins, metadata, nil
+}
+
+// RestoreFromTrash takes a login back out of the trash and returns it. It
+// fails with ErrLoginQuota if the user already has maxLogins logins outside
+// the trash.
+func (m LoginModel) RestoreFromTrash(id int64, user *User, maxLogins int) (*Login, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	count, err := m.countForUserTx(ctx, tx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+        UPDATE logins
+        SET deleted_at = NULL, merged_into_id = NULL, version = version + 1
+        WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL`
+
+	result, err := tx.ExecContext(ctx, query, id, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	// Only checked now, so a login that isn't in the trash is reported as
+	// not found rather than over the quota.
+	if rowsAffected == 0 {
+		return nil, ErrRecordNotFound
+	}
+
+	if count >= maxLogins {
+		return nil, ErrLoginQuota
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return m.Get(id, user)
+}
+
+// PurgeTrash permanently deletes every login that has been in the trash for
+// longer than retention, along with its revisions and attachments. It returns
+// the number of logins deleted.
+//
+// Logins merged into another are kept, with their history, for as long as
+// that login exists. Purging it clears their merged_into_id, and they go with
+// the next purge.
+//
+// The blobs of the attachments are deleted once the rows are gone. One that
+// can't be deleted is reported but doesn't undo the purge.
+func (m LoginModel) PurgeTrash(retention time.Duration) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Lock the logins first, so one restored from the trash part way through
+	// doesn't lose its attachments.
+	query := `
+        SELECT id
+        FROM logins
+        WHERE deleted_at < $1 AND merged_into_id IS NULL
+        FOR UPDATE`
+
+	rows, err := tx.QueryContext(ctx, query, time.Now().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+
+	var ids []int64
+
+	for rows.Next() {
+		var id int64
+
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	query = `
+        DELETE FROM attachments
+        WHERE login_id = ANY($1)
+        RETURNING blob_key`
+
+	rows, err = tx.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return 0, err
+	}
+
+	var blobKeys []string
+
+	for rows.Next() {
+		var key string
+
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		blobKeys = append(blobKeys, key)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM logins WHERE id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	for _, key := range blobKeys {
+		if blobErr := m.Blobs.Delete(ctx, key); blobErr != nil && err == nil {
+			err = fmt.Errorf("purging attachment blob %s: %w", key, blobErr)
+		}
+	}
+
+	return n, err
+}
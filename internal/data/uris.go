@@ -0,0 +1,285 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/robihdy/passman/internal/publicsuffix"
+	"github.com/robihdy/passman/internal/validator"
+	"gopkg.in/guregu/null.v4"
+)
+
+// How a login's URI is compared with the address of a page to decide whether
+// the login belongs to it.
+const (
+	URIMatchBaseDomain = "base_domain"
+	URIMatchHost       = "host"
+	URIMatchStartsWith = "starts_with"
+	URIMatchExact      = "exact"
+	URIMatchRegex      = "regex"
+	URIMatchNever      = "never"
+)
+
+var URIMatchTypes = []string{URIMatchBaseDomain, URIMatchHost, URIMatchStartsWith, URIMatchExact, URIMatchRegex, URIMatchNever}
+
+const (
+	maxURIsPerLogin = 32
+	maxURIBytes     = 2048
+)
+
+// URI is one of the addresses a login is used on. The first URI of a login is
+// its primary URI, which is also what the login's website is.
+type URI struct {
+	URI   string `json:"uri"`
+	Match string `json:"match"`
+}
+
+// NormalizeURIs trims URIs, defaults their match to base_domain and drops
+// repeated ones. Addresses other than regular expressions are normalized with
+// normalizeURL, so that "GitHub.com" and "https://github.com/" are the same.
+func NormalizeURIs(uris []URI) []URI {
+	seen := make(map[URI]bool)
+	normalized := []URI{}
+
+	for _, u := range uris {
+		u.URI = strings.TrimSpace(u.URI)
+
+		if u.Match == "" {
+			u.Match = URIMatchBaseDomain
+		}
+
+		if u.Match != URIMatchRegex {
+			u.URI = normalizeURL(u.URI)
+		}
+
+		if seen[u] {
+			continue
+		}
+
+		seen[u] = true
+		normalized = append(normalized, u)
+	}
+
+	return normalized
+}
+
+// normalizeURL gives an address without a scheme https, lowercases the scheme
+// and host, and drops a default port and a bare trailing slash. Anything that
+// doesn't parse is returned unchanged for validation to reject.
+func normalizeURL(s string) string {
+	if s == "" {
+		return s
+	}
+
+	if !strings.Contains(s, "://") {
+		s = "https://" + s
+	}
+
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return s
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+
+	if port := u.Port(); (u.Scheme == "https" && port == "443") || (u.Scheme == "http" && port == "80") {
+		u.Host = u.Hostname()
+		if strings.Contains(u.Host, ":") {
+			u.Host = "[" + u.Host + "]"
+		}
+	}
+
+	if u.Path == "/" && u.RawQuery == "" && u.Fragment == "" {
+		u.Path = ""
+	}
+
+	return u.String()
+}
+
+func validateURIs(v *validator.Validator, uris []URI) {
+	v.Check(len(uris) <= maxURIsPerLogin, "uris", "must not contain more than 32 URIs")
+
+	for i, u := range uris {
+		key := fmt.Sprintf("uris[%d]", i)
+
+		v.Check(u.URI != "", key+".uri", "must be provided")
+		v.Check(len(u.URI) <= maxURIBytes, key+".uri", "must not be more than 2048 bytes long")
+		v.Check(validator.In(u.Match, URIMatchTypes...), key+".match", "must be one of "+strings.Join(URIMatchTypes, ", "))
+
+		if u.URI == "" {
+			continue
+		}
+
+		switch u.Match {
+		case URIMatchRegex:
+			_, err := regexp.Compile(u.URI)
+			v.Check(err == nil, key+".uri", "must be a valid regular expression")
+		default:
+			parsed, err := url.Parse(u.URI)
+			v.Check(err == nil && parsed.Scheme != "" && parsed.Host != "" && validHost(parsed.Hostname()), key+".uri", "must be an absolute URL")
+		}
+	}
+}
+
+// validHost reports whether host is an IP address or a plausible domain name.
+func validHost(host string) bool {
+	if net.ParseIP(host) != nil {
+		return true
+	}
+
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || strings.ContainsAny(label, " \t/\\") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// SetPrimaryURI replaces the address of the login's primary URI, keeping its
+// match, or adds one if the login has none. An empty address removes the
+// primary URI. It keeps the single website field of the API working now that
+// a login has a list of URIs.
+func (l *Login) SetPrimaryURI(address string) {
+	switch {
+	case address == "" && len(l.URIs) > 0:
+		l.URIs = l.URIs[1:]
+	case address == "":
+	case len(l.URIs) > 0:
+		uris := append([]URI{}, l.URIs...)
+		uris[0].URI = address
+		l.URIs = uris
+	default:
+		l.URIs = []URI{{URI: address}}
+	}
+}
+
+// ValidateMatchURL checks the address of a page that logins are looked up
+// for.
+func ValidateMatchURL(v *validator.Validator, address string) {
+	v.Check(address != "", "url", "must be provided")
+	v.Check(len(address) <= maxURIBytes, "url", "must not be more than 2048 bytes long")
+
+	parsed, err := url.Parse(normalizeURL(address))
+	v.Check(err == nil && parsed.Host != "" && validHost(parsed.Hostname()), "url", "must be an absolute URL")
+}
+
+// How specifically a URI matches a page, from least to most specific. A login
+// is ranked by the most specific of its URIs that match.
+const (
+	matchNone = iota
+	matchBaseDomain
+	matchHost
+	matchRegex
+	matchStartsWith
+	matchExact
+)
+
+// match reports how specifically the URI matches the page at target, which
+// has been normalized, or matchNone if it doesn't. Regular expressions are
+// matched against the normalized address too. A starts_with URI only matches
+// pages with the same scheme and host, and compares paths a segment at a
+// time.
+func (u URI) match(target *url.URL) int {
+	switch u.Match {
+	case URIMatchExact:
+		if u.URI == target.String() {
+			return matchExact
+		}
+	case URIMatchStartsWith:
+		parsed, err := url.Parse(u.URI)
+		if err == nil && parsed.Scheme == target.Scheme && parsed.Host == target.Host &&
+			hasPathPrefix(target.EscapedPath(), parsed.EscapedPath()) {
+			return matchStartsWith
+		}
+	case URIMatchRegex:
+		re, err := regexp.Compile(u.URI)
+		if err == nil && re.MatchString(target.String()) {
+			return matchRegex
+		}
+	case URIMatchHost:
+		parsed, err := url.Parse(u.URI)
+		if err == nil && parsed.Host == target.Host {
+			return matchHost
+		}
+	case URIMatchBaseDomain:
+		parsed, err := url.Parse(u.URI)
+		if err == nil && baseDomain(parsed.Hostname()) == baseDomain(target.Hostname()) {
+			return matchBaseDomain
+		}
+	}
+
+	return matchNone
+}
+
+// hasPathPrefix reports whether path is prefix or lies below it, so "/app"
+// covers "/app" and "/app/login" but not "/application".
+func hasPathPrefix(path, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+
+	return prefix == "" || path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// matchURIs returns how specifically the best of uris matches the page at
+// target.
+func matchURIs(uris []URI, target *url.URL) int {
+	best := matchNone
+
+	for _, u := range uris {
+		if m := u.match(target); m > best {
+			best = m
+		}
+	}
+
+	return best
+}
+
+// baseDomain returns the registrable domain of host, so "ci.example.co.uk"
+// and "www.example.co.uk" share "example.co.uk". IP addresses, single-label
+// names like localhost and public suffixes are their own base domain.
+func baseDomain(host string) string {
+	if net.ParseIP(host) != nil {
+		return host
+	}
+
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return strings.ToLower(host)
+	}
+
+	return domain
+}
+
+// primaryURI returns the address of the first URI, which is stored as the
+// login's website so that logins can still be sorted and searched by it.
+func primaryURI(uris []URI) null.String {
+	if len(uris) == 0 {
+		return null.String{}
+	}
+
+	return null.StringFrom(uris[0].URI)
+}
+
+func marshalURIs(uris []URI) ([]byte, error) {
+	if uris == nil {
+		uris = []URI{}
+	}
+
+	return json.Marshal(uris)
+}
+
+func unmarshalURIs(stored []byte) ([]URI, error) {
+	uris := []URI{}
+
+	if len(stored) == 0 {
+		return uris, nil
+	}
+
+	err := json.Unmarshal(stored, &uris)
+	return uris, err
+}
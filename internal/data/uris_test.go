@@ -0,0 +1,80 @@
+package data
+
+import (
+	"net/url"
+	"testing"
+)
+
+func parseTarget(t *testing.T, address string) *url.URL {
+	t.Helper()
+
+	target, err := url.Parse(normalizeURL(address))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return target
+}
+
+func TestURIMatch(t *testing.T) {
+	tests := []struct {
+		uri    URI
+		target string
+		want   int
+	}{
+		{URI{"https://example.com/app", URIMatchStartsWith}, "https://example.com/app", matchStartsWith},
+		{URI{"https://example.com/app", URIMatchStartsWith}, "https://example.com/app/login?next=1", matchStartsWith},
+		{URI{"https://example.com/app/", URIMatchStartsWith}, "https://example.com/app/login", matchStartsWith},
+		{URI{"https://example.com", URIMatchStartsWith}, "https://example.com/anything", matchStartsWith},
+		{URI{"https://example.com/app", URIMatchStartsWith}, "https://example.com/application", matchNone},
+		{URI{"https://example.com", URIMatchStartsWith}, "https://example.com.evil.test/", matchNone},
+		{URI{"https://example.com", URIMatchStartsWith}, "https://example.com:8443/", matchNone},
+		{URI{"https://example.com/app", URIMatchStartsWith}, "http://example.com/app", matchNone},
+		{URI{"https://example.com/app", URIMatchStartsWith}, "https://www.example.com/app", matchNone},
+
+		{URI{"https://example.com/login", URIMatchExact}, "https://Example.com/login", matchExact},
+		{URI{"https://example.com/login", URIMatchExact}, "https://example.com/login/", matchNone},
+
+		{URI{`^https://[a-z]+\.example\.com(/|$)`, URIMatchRegex}, "https://ci.example.com/", matchRegex},
+		{URI{`(`, URIMatchRegex}, "https://example.com/", matchNone},
+
+		{URI{"https://ci.example.com", URIMatchHost}, "https://ci.example.com/jobs", matchHost},
+		{URI{"https://ci.example.com", URIMatchHost}, "https://www.example.com/", matchNone},
+
+		{URI{"https://ci.example.co.uk", URIMatchBaseDomain}, "https://www.example.co.uk/", matchBaseDomain},
+		{URI{"https://example.co.uk", URIMatchBaseDomain}, "https://other.co.uk/", matchNone},
+
+		{URI{"https://example.com", URIMatchNever}, "https://example.com", matchNone},
+	}
+
+	for _, tt := range tests {
+		if got := tt.uri.match(parseTarget(t, tt.target)); got != tt.want {
+			t.Errorf("%s %q against %q: got %d, want %d", tt.uri.Match, tt.uri.URI, tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestMatchURIs(t *testing.T) {
+	uris := []URI{
+		{"https://example.com", URIMatchBaseDomain},
+		{"https://example.com/app", URIMatchStartsWith},
+		{"https://example.com/app/login", URIMatchExact},
+	}
+
+	tests := map[string]int{
+		"https://example.com/app/login": matchExact,
+		"https://example.com/app/home":  matchStartsWith,
+		"https://www.example.com/app":   matchBaseDomain,
+		"https://example.org/app":       matchNone,
+	}
+
+	for target, want := range tests {
+		if got := matchURIs(uris, parseTarget(t, target)); got != want {
+			t.Errorf("matchURIs against %q: got %d, want %d", target, got, want)
+		}
+	}
+
+	if got := matchURIs(nil, parseTarget(t, "https://example.com")); got != matchNone {
+		t.Errorf("matchURIs without URIs: got %d, want matchNone", got)
+	}
+}
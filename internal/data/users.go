@@ -2,19 +2,30 @@ package data
 
 import (
 	"context"
+	"crypto/rand"
 	"crypto/sha256"
 	"database/sql"
 	"errors"
 	"time"
 
+	"github.com/robihdy/passman/internal/encryption"
 	"github.com/robihdy/passman/internal/validator"
 	"golang.org/x/crypto/bcrypt"
 )
 
 var (
 	ErrDuplicateEmail = errors.New("duplicate email")
+	ErrDataKeyLocked  = errors.New("data key locked")
 )
 
+const (
+	dataKeyID         = "user"
+	passwordKEKID     = "password"
+	dataKeySaltLength = 16
+)
+
+var dataKeyWrapAD = []byte("users:data_key")
+
 var AnonymousUser = &User{}
 
 type User struct {
@@ -31,23 +42,102 @@ func (u *User) IsAnonymous() bool {
 	return u == AnonymousUser
 }
 
+// HasDataKey reports whether the user has a data encryption key. Accounts
+// created before per-user keys were introduced get one the next time they log
+// in with their password.
+func (u *User) HasDataKey() bool {
+	return u.Password.wrappedKey != nil
+}
+
+// DataKeyUnlocked reports whether the user's data encryption key is available
+// to decrypt their logins.
+func (u *User) DataKeyUnlocked() bool {
+	return u.Password.dataKey != nil
+}
+
+func (u *User) dataKey() (*encryption.Key, error) {
+	if u.Password.dataKey == nil {
+		return nil, ErrDataKeyLocked
+	}
+	return u.Password.dataKey, nil
+}
+
+// password holds the bcrypt hash used to authenticate the user, along with
+// their data encryption key. That key encrypts the user's logins and is stored
+// wrapped by a key derived from the plaintext password, so it can only be
+// unwrapped while the user's password (or an active session) is at hand.
 type password struct {
-	plaintext *string
-	hash      []byte
+	plaintext  *string
+	hash       []byte
+	wrappedKey []byte
+	salt       []byte
+	dataKey    *encryption.Key
 }
 
+// Set hashes the new password and wraps the user's data encryption key with
+// it, generating the key first if the user doesn't have one yet. Changing the
+// password of a user who already has a key only rewraps that key, so the key
+// must have been unlocked first.
 func (p *password) Set(plaintextPassword string) error {
+	if p.wrappedKey != nil && p.dataKey == nil {
+		return ErrDataKeyLocked
+	}
+
 	hash, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), 12)
 	if err != nil {
 		return err
 	}
 
+	dataKey := p.dataKey
+	if dataKey == nil {
+		dataKey, err = encryption.GenerateKey(dataKeyID)
+		if err != nil {
+			return err
+		}
+	}
+
+	salt := make([]byte, dataKeySaltLength)
+
+	_, err = rand.Read(salt)
+	if err != nil {
+		return err
+	}
+
+	kek, err := encryption.DeriveKey(passwordKEKID, []byte(plaintextPassword), salt, encryption.DefaultArgon2Params)
+	if err != nil {
+		return err
+	}
+
+	wrappedKey, err := encryption.WrapKey(kek, dataKey, dataKeyWrapAD)
+	if err != nil {
+		return err
+	}
+
 	p.plaintext = &plaintextPassword
 	p.hash = hash
+	p.wrappedKey = wrappedKey
+	p.salt = salt
+	p.dataKey = dataKey
 
 	return nil
 }
 
+// Unlock unwraps the data encryption key with the plaintext password. The
+// password must already have been checked with Matches.
+func (p *password) Unlock(plaintextPassword string) error {
+	if p.wrappedKey == nil {
+		return ErrDataKeyLocked
+	}
+
+	kek, err := encryption.DeriveKey(passwordKEKID, []byte(plaintextPassword), p.salt, encryption.DefaultArgon2Params)
+	if err != nil {
+		return err
+	}
+
+	p.dataKey, err = encryption.UnwrapKey(kek, dataKeyID, p.wrappedKey, dataKeyWrapAD)
+	return err
+}
+
 func (p *password) Matches(plaintextPassword string) (bool, error) {
 	err := bcrypt.CompareHashAndPassword(p.hash, []byte(plaintextPassword))
 	if err != nil {
@@ -94,11 +184,11 @@ type UserModel struct {
 
 func (m UserModel) Insert(user *User) error {
 	query := `
-        INSERT INTO users (name, email, password_hash, activated) 
-        VALUES ($1, $2, $3, $4)
+        INSERT INTO users (name, email, password_hash, data_key, data_key_salt, activated) 
+        VALUES ($1, $2, $3, $4, $5, $6)
         RETURNING id, created_at, version`
 
-	args := []interface{}{user.Name, user.Email, user.Password.hash, user.Activated}
+	args := []interface{}{user.Name, user.Email, user.Password.hash, user.Password.wrappedKey, user.Password.salt, user.Activated}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -118,7 +208,7 @@ func (m UserModel) Insert(user *User) error {
 
 func (m UserModel) GetByEmail(email string) (*User, error) {
 	query := `
-        SELECT id, created_at, name, email, password_hash, activated, version
+        SELECT id, created_at, name, email, password_hash, data_key, data_key_salt, activated, version
         FROM users
         WHERE email = $1`
 
@@ -133,6 +223,8 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 		&user.Name,
 		&user.Email,
 		&user.Password.hash,
+		&user.Password.wrappedKey,
+		&user.Password.salt,
 		&user.Activated,
 		&user.Version,
 	)
@@ -150,25 +242,36 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 }
 
 func (m UserModel) Update(user *User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.update(ctx, m.DB, user)
+}
+
+// UpdateTx is Update as part of the caller's transaction.
+func (m UserModel) UpdateTx(ctx context.Context, tx *sql.Tx, user *User) error {
+	return m.update(ctx, tx, user)
+}
+
+func (m UserModel) update(ctx context.Context, q queryer, user *User) error {
 	query := `
         UPDATE users 
-        SET name = $1, email = $2, password_hash = $3, activated = $4, version = version + 1
-        WHERE id = $5 AND version = $6
+        SET name = $1, email = $2, password_hash = $3, data_key = $4, data_key_salt = $5, activated = $6, version = version + 1
+        WHERE id = $7 AND version = $8
         RETURNING version`
 
 	args := []interface{}{
 		user.Name,
 		user.Email,
 		user.Password.hash,
+		user.Password.wrappedKey,
+		user.Password.salt,
 		user.Activated,
 		user.ID,
 		user.Version,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.Version)
+	err := q.QueryRowContext(ctx, query, args...).Scan(&user.Version)
 	if err != nil {
 		switch {
 		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
@@ -183,11 +286,15 @@ func (m UserModel) Update(user *User) error {
 	return nil
 }
 
+// GetForToken returns the user a token belongs to. If the token carries the
+// user's data encryption key it is unwrapped, so the user's logins can be
+// decrypted for the rest of the request.
 func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error) {
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 
 	query := `
-        SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
+        SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.data_key, users.data_key_salt,
+            users.activated, users.version, tokens.data_key
         FROM users
         INNER JOIN tokens
         ON users.id = tokens.user_id
@@ -197,7 +304,10 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 
 	args := []interface{}{tokenHash[:], tokenScope, time.Now()}
 
-	var user User
+	var (
+		user       User
+		sessionKey []byte
+	)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -208,8 +318,11 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 		&user.Name,
 		&user.Email,
 		&user.Password.hash,
+		&user.Password.wrappedKey,
+		&user.Password.salt,
 		&user.Activated,
 		&user.Version,
+		&sessionKey,
 	)
 	if err != nil {
 		switch {
@@ -220,5 +333,12 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 		}
 	}
 
+	if sessionKey != nil {
+		user.Password.dataKey, err = unwrapSessionKey(tokenPlaintext, user.ID, sessionKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &user, nil
 }
@@ -5,58 +5,156 @@ import (
 	"crypto/cipher"
 	"crypto/rand"
 	"encoding/hex"
-	"fmt"
+	"errors"
 	"io"
 )
 
-func Encrypt(stringToEncrypt string, keyString string) (encryptedString string) {
-	key, _ := hex.DecodeString(keyString)
-	plaintext := []byte(stringToEncrypt)
+var (
+	ErrInvalidKey          = errors.New("encryption: invalid key")
+	ErrUnknownKey          = errors.New("encryption: ciphertext was sealed with an unknown key")
+	ErrMalformedCiphertext = errors.New("encryption: malformed ciphertext")
+	ErrTampered            = errors.New("encryption: ciphertext failed authentication")
+	ErrUnsupportedVersion  = errors.New("encryption: unsupported ciphertext version")
+	ErrUnsupportedAlg      = errors.New("encryption: unsupported ciphertext algorithm")
+)
+
+// KeySize is the length in bytes of the keys used with AES-256-GCM.
+const KeySize = 32
+
+type Key struct {
+	ID       string
+	material []byte
+}
+
+// NewKey returns a key with the given ID. The ID is recorded in every
+// ciphertext sealed with the key so the right key can be found again when
+// decrypting.
+func NewKey(id string, material []byte) (*Key, error) {
+	if id == "" || len(id) > maxKeyIDLength {
+		return nil, ErrInvalidKey
+	}
+
+	if len(material) != KeySize {
+		return nil, ErrInvalidKey
+	}
+
+	k := &Key{ID: id, material: make([]byte, KeySize)}
+	copy(k.material, material)
+
+	return k, nil
+}
 
-	block, err := aes.NewCipher(key)
+// ParseKey is like NewKey but takes the key material as a hex string.
+func ParseKey(id, hexMaterial string) (*Key, error) {
+	material, err := hex.DecodeString(hexMaterial)
 	if err != nil {
-		panic(err.Error())
+		return nil, ErrInvalidKey
 	}
 
-	// Create a new GCM - https://en.wikipedia.org/wiki/Galois/Counter_Mode
-	// https://golang.org/pkg/crypto/cipher/#NewGCM
-	aesGCM, err := cipher.NewGCM(block)
+	return NewKey(id, material)
+}
+
+// Wipe overwrites the key material with zeros. The key is unusable after.
+func (k *Key) Wipe() {
+	for i := range k.material {
+		k.material[i] = 0
+	}
+}
+
+// Encrypt seals plaintext with AES-256-GCM and returns it wrapped in a
+// versioned envelope. The additional data is authenticated but not stored, so
+// the exact same bytes must be passed to Decrypt.
+func (k *Key) Encrypt(plaintext, additionalData []byte) ([]byte, error) {
+	aead, err := k.aead()
 	if err != nil {
-		panic(err.Error())
+		return nil, err
+	}
+
+	env := &Envelope{
+		Version:   CurrentVersion,
+		Algorithm: AlgAES256GCM,
+		KeyID:     k.ID,
+		Nonce:     make([]byte, aead.NonceSize()),
+	}
+
+	if _, err := io.ReadFull(rand.Reader, env.Nonce); err != nil {
+		return nil, err
 	}
 
-	nonce := make([]byte, aesGCM.NonceSize())
-	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
-		panic(err.Error())
+	env.Ciphertext = aead.Seal(nil, env.Nonce, plaintext, env.additionalData(additionalData))
+
+	return env.Bytes(), nil
+}
+
+// Decrypt opens an envelope produced by Encrypt.
+func (k *Key) Decrypt(ciphertext, additionalData []byte) ([]byte, error) {
+	env, err := ParseEnvelope(ciphertext)
+	if err != nil {
+		return nil, err
 	}
 
-	ciphertext := aesGCM.Seal(nonce, nonce, plaintext, nil)
-	return fmt.Sprintf("%x", ciphertext)
+	return k.open(env, additionalData)
 }
 
-func Decrypt(encryptedString string, keyString string) (decryptedString string) {
-	key, _ := hex.DecodeString(keyString)
-	enc, _ := hex.DecodeString(encryptedString)
+func (k *Key) open(env *Envelope, additionalData []byte) ([]byte, error) {
+	if env.KeyID != k.ID {
+		return nil, ErrUnknownKey
+	}
+
+	aead, err := k.aead()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(env.Nonce) != aead.NonceSize() {
+		return nil, ErrMalformedCiphertext
+	}
+
+	plaintext, err := aead.Open(nil, env.Nonce, env.Ciphertext, env.additionalData(additionalData))
+	if err != nil {
+		return nil, ErrTampered
+	}
+
+	return plaintext, nil
+}
 
-	block, err := aes.NewCipher(key)
+func (k *Key) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(k.material)
 	if err != nil {
-		panic(err.Error())
+		return nil, ErrInvalidKey
 	}
 
-	aesGCM, err := cipher.NewGCM(block)
+	// Create a new GCM - https://en.wikipedia.org/wiki/Galois/Counter_Mode
+	// https://golang.org/pkg/crypto/cipher/#NewGCM
+	return cipher.NewGCM(block)
+}
+
+// DecryptLegacy opens a hex-encoded nonce||ciphertext value written before
+// ciphertexts were wrapped in an Envelope. It exists only so that old rows can
+// be re-encrypted and must not be used for new data.
+func DecryptLegacy(k *Key, hexCiphertext []byte) ([]byte, error) {
+	enc := make([]byte, hex.DecodedLen(len(hexCiphertext)))
+	if _, err := hex.Decode(enc, hexCiphertext); err != nil {
+		return nil, ErrMalformedCiphertext
+	}
+
+	aead, err := k.aead()
 	if err != nil {
-		panic(err.Error())
+		return nil, err
 	}
 
-	nonceSize := aesGCM.NonceSize()
+	nonceSize := aead.NonceSize()
+	if len(enc) < nonceSize+aead.Overhead() {
+		return nil, ErrMalformedCiphertext
+	}
 
 	// Extract the nonce from the encrypted data
 	nonce, ciphertext := enc[:nonceSize], enc[nonceSize:]
 
-	plaintext, err := aesGCM.Open(nil, nonce, ciphertext, nil)
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
 	if err != nil {
-		panic(err.Error())
+		return nil, ErrTampered
 	}
 
-	return fmt.Sprintf("%s", plaintext)
+	return plaintext, nil
 }
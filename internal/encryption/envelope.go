@@ -0,0 +1,97 @@
+package encryption
+
+// Algorithm identifies the cipher used to seal an Envelope.
+type Algorithm byte
+
+const (
+	AlgAES256GCM Algorithm = 1
+)
+
+// CurrentVersion is the envelope format written by Encrypt.
+const CurrentVersion byte = 1
+
+const maxKeyIDLength = 255
+
+// Envelope is the self-describing wire format of every ciphertext:
+//
+//	version (1) | algorithm (1) | len(key id) (1) | key id | len(nonce) (1) | nonce | ciphertext
+//
+// Everything before the ciphertext is authenticated along with the caller's
+// additional data, so the header cannot be altered without Decrypt failing.
+type Envelope struct {
+	Version    byte
+	Algorithm  Algorithm
+	KeyID      string
+	Nonce      []byte
+	Ciphertext []byte
+}
+
+// ParseEnvelope splits an encoded envelope into its parts without decrypting
+// it.
+func ParseEnvelope(b []byte) (*Envelope, error) {
+	if len(b) < 1 {
+		return nil, ErrMalformedCiphertext
+	}
+
+	if b[0] != CurrentVersion {
+		return nil, ErrUnsupportedVersion
+	}
+
+	if len(b) < 3 {
+		return nil, ErrMalformedCiphertext
+	}
+
+	env := &Envelope{Version: b[0], Algorithm: Algorithm(b[1])}
+	if env.Algorithm != AlgAES256GCM {
+		return nil, ErrUnsupportedAlg
+	}
+
+	b = b[2:]
+
+	keyID, b, ok := readPrefixed(b)
+	if !ok || len(keyID) == 0 {
+		return nil, ErrMalformedCiphertext
+	}
+	env.KeyID = string(keyID)
+
+	env.Nonce, b, ok = readPrefixed(b)
+	if !ok {
+		return nil, ErrMalformedCiphertext
+	}
+
+	env.Ciphertext = b
+
+	return env, nil
+}
+
+// Bytes encodes the envelope.
+func (e *Envelope) Bytes() []byte {
+	return append(e.header(), e.Ciphertext...)
+}
+
+func (e *Envelope) header() []byte {
+	h := make([]byte, 0, 4+len(e.KeyID)+len(e.Nonce))
+	h = append(h, e.Version, byte(e.Algorithm))
+	h = append(h, byte(len(e.KeyID)))
+	h = append(h, e.KeyID...)
+	h = append(h, byte(len(e.Nonce)))
+	h = append(h, e.Nonce...)
+	return h
+}
+
+func (e *Envelope) additionalData(ad []byte) []byte {
+	return append(e.header(), ad...)
+}
+
+func readPrefixed(b []byte) (field, rest []byte, ok bool) {
+	if len(b) < 1 {
+		return nil, nil, false
+	}
+
+	n := int(b[0])
+	if len(b) < 1+n {
+		return nil, nil, false
+	}
+
+	return b[1 : 1+n], b[1+n:], true
+}
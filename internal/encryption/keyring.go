@@ -0,0 +1,255 @@
+package encryption
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+var ErrSealed = errors.New("encryption: key ring is sealed")
+
+// KeyRing holds every key the server knows about. New ciphertexts are always
+// sealed with the active key, while any key in the ring can be used to open
+// existing ones, so a key can be rotated out without making old data
+// unreadable.
+//
+// Rotating a key, whether on schedule or after a suspected leak, is done by
+// starting the server with a freshly generated active key and the previous key
+// moved to the retired list, running the re-encryption job until it reports no
+// more rows, and then restarting without the retired key.
+//
+// A ring can also be sealed, in which case it holds no key material at all and
+// every operation fails with ErrSealed until it is unsealed again.
+type KeyRing struct {
+	mu     sync.RWMutex
+	active *Key
+	keys   map[string]*Key
+}
+
+// NewKeyRing returns a ring that seals with active and can additionally open
+// ciphertexts sealed with any of the retired keys.
+func NewKeyRing(active *Key, retired ...*Key) (*KeyRing, error) {
+	r := &KeyRing{}
+
+	err := r.Unseal(active, retired...)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// NewSealedKeyRing returns a ring without any keys. It must be unsealed before
+// it can be used.
+func NewSealedKeyRing() *KeyRing {
+	return &KeyRing{}
+}
+
+// Unseal loads the given keys into the ring, replacing any it already held.
+func (r *KeyRing) Unseal(active *Key, retired ...*Key) error {
+	if active == nil {
+		return ErrInvalidKey
+	}
+
+	keys := map[string]*Key{active.ID: active}
+
+	for _, k := range retired {
+		if _, exists := keys[k.ID]; exists {
+			return fmt.Errorf("encryption: duplicate key id %q", k.ID)
+		}
+		keys[k.ID] = k
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.active = active
+	r.keys = keys
+
+	return nil
+}
+
+// Seal wipes every key from memory. The ring refuses to encrypt or decrypt
+// until it is unsealed again.
+func (r *KeyRing) Seal() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, k := range r.keys {
+		k.Wipe()
+	}
+
+	r.active = nil
+	r.keys = nil
+}
+
+// Sealed reports whether the ring currently holds no keys.
+func (r *KeyRing) Sealed() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.active == nil
+}
+
+// ActiveID returns the ID of the key used for new ciphertexts, or an empty
+// string if the ring is sealed.
+func (r *KeyRing) ActiveID() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.active == nil {
+		return ""
+	}
+
+	return r.active.ID
+}
+
+// Encrypt seals plaintext with the active key.
+func (r *KeyRing) Encrypt(plaintext, additionalData []byte) ([]byte, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.active == nil {
+		return nil, ErrSealed
+	}
+
+	return r.active.Encrypt(plaintext, additionalData)
+}
+
+// Decrypt opens a ciphertext with whichever key in the ring sealed it.
+func (r *KeyRing) Decrypt(ciphertext, additionalData []byte) ([]byte, error) {
+	env, err := ParseEnvelope(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.active == nil {
+		return nil, ErrSealed
+	}
+
+	k, ok := r.keys[env.KeyID]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	return k.open(env, additionalData)
+}
+
+// DecryptLegacy opens a value in the legacy unversioned format. Those values
+// don't record which key sealed them, so every key in the ring is tried.
+func (r *KeyRing) DecryptLegacy(hexCiphertext []byte) ([]byte, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.active == nil {
+		return nil, ErrSealed
+	}
+
+	err := ErrUnknownKey
+
+	for _, k := range r.keys {
+		var plaintext []byte
+
+		plaintext, err = DecryptLegacy(k, hexCiphertext)
+		if err == nil {
+			return plaintext, nil
+		}
+		if errors.Is(err, ErrMalformedCiphertext) {
+			return nil, err
+		}
+	}
+
+	return nil, err
+}
+
+// ParseKeys parses a whitespace separated list of id:hex pairs, the format
+// used to pass retired keys on the command line.
+func ParseKeys(s string) ([]*Key, error) {
+	var keys []*Key
+
+	for _, field := range strings.Fields(s) {
+		parts := strings.SplitN(field, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("encryption: key %q is not in id:hex form", field)
+		}
+
+		k, err := ParseKey(parts[0], parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("encryption: key %q: %w", parts[0], err)
+		}
+
+		keys = append(keys, k)
+	}
+
+	return keys, nil
+}
+
+// WrapKeys seals each key with kek and returns them as a whitespace separated
+// list of id:hex pairs, like ParseKeys takes but safe to keep in the
+// configuration: without kek the list is useless.
+func WrapKeys(kek *Key, keys []*Key) (string, error) {
+	fields := make([]string, len(keys))
+
+	for i, k := range keys {
+		wrapped, err := WrapKey(kek, k, wrappedKeyAD(k.ID))
+		if err != nil {
+			return "", err
+		}
+
+		fields[i] = k.ID + ":" + hex.EncodeToString(wrapped)
+	}
+
+	return strings.Join(fields, " "), nil
+}
+
+// UnwrapKeys is the reverse of WrapKeys.
+func UnwrapKeys(kek *Key, s string) ([]*Key, error) {
+	var keys []*Key
+
+	for _, field := range strings.Fields(s) {
+		parts := strings.SplitN(field, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("encryption: wrapped key %q is not in id:hex form", field)
+		}
+
+		wrapped, err := hex.DecodeString(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("encryption: wrapped key %q: %w", parts[0], ErrMalformedCiphertext)
+		}
+
+		k, err := UnwrapKey(kek, parts[0], wrapped, wrappedKeyAD(parts[0]))
+		if err != nil {
+			return nil, fmt.Errorf("encryption: wrapped key %q: %w", parts[0], err)
+		}
+
+		keys = append(keys, k)
+	}
+
+	return keys, nil
+}
+
+// wrappedKeyAD binds a key wrapped by WrapKeys to its ID, so a wrapped key
+// can't be passed off under another key's ID.
+func wrappedKeyAD(id string) []byte {
+	return []byte("passman-wrapped-key:" + id)
+}
+
+const keyCheckPlaintext = "passman-key-check"
+
+// NewKeyCheck returns a value sealed with k that VerifyKeyCheck can later use
+// to confirm a key rebuilt from elsewhere, such as from unseal shares, is the
+// same key.
+func NewKeyCheck(k *Key) ([]byte, error) {
+	return k.Encrypt([]byte(keyCheckPlaintext), nil)
+}
+
+// VerifyKeyCheck reports whether check was produced by NewKeyCheck with k.
+func VerifyKeyCheck(k *Key, check []byte) bool {
+	plaintext, err := k.Decrypt(check, nil)
+	return err == nil && string(plaintext) == keyCheckPlaintext
+}
@@ -0,0 +1,97 @@
+package encryption
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// KeyProvider supplies the key the server seals new ciphertexts with. It lets
+// the key live wherever operations prefer (an environment variable, a file, a
+// passphrase or an external KMS) without the rest of the code caring.
+type KeyProvider interface {
+	Key(ctx context.Context) (*Key, error)
+}
+
+// EnvKeyProvider reads a hex-encoded key from an environment variable.
+type EnvKeyProvider struct {
+	ID  string
+	Var string
+}
+
+func (p EnvKeyProvider) Key(ctx context.Context) (*Key, error) {
+	value := os.Getenv(p.Var)
+	if value == "" {
+		return nil, fmt.Errorf("encryption: environment variable %s is not set", p.Var)
+	}
+
+	return ParseKey(p.ID, strings.TrimSpace(value))
+}
+
+// FileKeyProvider reads a hex-encoded key from a file. The file must be a
+// regular file that is not readable or writable by anyone but its owner.
+type FileKeyProvider struct {
+	ID   string
+	Path string
+}
+
+func (p FileKeyProvider) Key(ctx context.Context) (*Key, error) {
+	info, err := os.Lstat(p.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("encryption: key file %s is not a regular file", p.Path)
+	}
+
+	if info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("encryption: key file %s has permissions %04o, must not be accessible by group or others", p.Path, info.Mode().Perm())
+	}
+
+	b, err := ioutil.ReadFile(p.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseKey(p.ID, strings.TrimSpace(string(b)))
+}
+
+// Default Argon2id parameters for PassphraseKeyProvider. Changing them changes
+// the derived key, so they must stay fixed for as long as the key is in use.
+const (
+	DefaultArgon2Time    = 3
+	DefaultArgon2Memory  = 64 * 1024
+	DefaultArgon2Threads = 4
+)
+
+// PassphraseKeyProvider derives the key from a passphrase with Argon2id.
+type PassphraseKeyProvider struct {
+	ID         string
+	Passphrase []byte
+	Salt       []byte
+	Time       uint32
+	Memory     uint32
+	Threads    uint8
+}
+
+func (p PassphraseKeyProvider) Key(ctx context.Context) (*Key, error) {
+	if len(p.Passphrase) == 0 {
+		return nil, errors.New("encryption: passphrase must not be empty")
+	}
+
+	if len(p.Salt) < 16 {
+		return nil, errors.New("encryption: passphrase salt must be at least 16 bytes long")
+	}
+
+	if p.Time == 0 || p.Memory == 0 || p.Threads == 0 {
+		return nil, errors.New("encryption: argon2 parameters must be greater than zero")
+	}
+
+	params := Argon2Params{Time: p.Time, Memory: p.Memory, Threads: p.Threads}
+
+	return DeriveKey(p.ID, p.Passphrase, p.Salt, params)
+}
@@ -0,0 +1,183 @@
+package encryption
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// ChunkSize is the amount of plaintext sealed in each chunk of a stream.
+const ChunkSize = 64 * 1024
+
+const (
+	streamVersion     byte = 1
+	streamNoncePrefix      = 7
+)
+
+// EncryptStream seals everything read from src and writes it to dst. It
+// returns the number of plaintext bytes read.
+//
+// The stream is sealed in chunks so that large files never have to be held in
+// memory:
+//
+//	version (1) | algorithm (1) | len(key id) (1) | key id | nonce prefix (7) | chunk...
+//
+// Every chunk but the last holds ChunkSize bytes of plaintext. Each is sealed
+// with AES-256-GCM under the nonce prefix || chunk counter (4) || last chunk
+// flag (1), so chunks cannot be reordered, dropped or truncated away without
+// DecryptStream failing. The header is authenticated with every chunk along
+// with the caller's additional data.
+func (k *Key) EncryptStream(dst io.Writer, src io.Reader, additionalData []byte) (int64, error) {
+	aead, err := k.aead()
+	if err != nil {
+		return 0, err
+	}
+
+	prefix := make([]byte, streamNoncePrefix)
+	if _, err := io.ReadFull(rand.Reader, prefix); err != nil {
+		return 0, err
+	}
+
+	header := make([]byte, 0, 3+len(k.ID)+len(prefix))
+	header = append(header, streamVersion, byte(AlgAES256GCM), byte(len(k.ID)))
+	header = append(header, k.ID...)
+	header = append(header, prefix...)
+
+	if _, err := dst.Write(header); err != nil {
+		return 0, err
+	}
+
+	ad := append(header[:len(header):len(header)], additionalData...)
+	br := bufio.NewReader(src)
+	plaintext := make([]byte, ChunkSize)
+	sealed := make([]byte, 0, ChunkSize+aead.Overhead())
+
+	var total int64
+
+	for counter := uint32(0); ; counter++ {
+		n, err := io.ReadFull(br, plaintext)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return total, err
+		}
+		total += int64(n)
+
+		last := n < ChunkSize
+		if !last {
+			if _, err := br.Peek(1); err == io.EOF {
+				last = true
+			} else if err != nil {
+				return total, err
+			}
+		}
+
+		if !last && counter == math.MaxUint32 {
+			return total, errors.New("encryption: stream too long")
+		}
+
+		sealed = aead.Seal(sealed[:0], chunkNonce(prefix, counter, last), plaintext[:n], ad)
+
+		if _, err := dst.Write(sealed); err != nil {
+			return total, err
+		}
+
+		if last {
+			return total, nil
+		}
+	}
+}
+
+// DecryptStream opens a stream produced by EncryptStream and writes the
+// plaintext to dst. Each chunk is only written once it has been authenticated,
+// but a stream that fails part way through will already have written its
+// earlier chunks. It returns the number of plaintext bytes written.
+func (k *Key) DecryptStream(dst io.Writer, src io.Reader, additionalData []byte) (int64, error) {
+	br := bufio.NewReader(src)
+
+	fixed := make([]byte, 3)
+	if _, err := io.ReadFull(br, fixed); err != nil {
+		return 0, ErrMalformedCiphertext
+	}
+
+	if fixed[0] != streamVersion {
+		return 0, ErrUnsupportedVersion
+	}
+
+	if Algorithm(fixed[1]) != AlgAES256GCM {
+		return 0, ErrUnsupportedAlg
+	}
+
+	rest := make([]byte, int(fixed[2])+streamNoncePrefix)
+	if _, err := io.ReadFull(br, rest); err != nil {
+		return 0, ErrMalformedCiphertext
+	}
+
+	if string(rest[:fixed[2]]) != k.ID {
+		return 0, ErrUnknownKey
+	}
+
+	aead, err := k.aead()
+	if err != nil {
+		return 0, err
+	}
+
+	header := append(fixed, rest...)
+	ad := append(header[:len(header):len(header)], additionalData...)
+	prefix := rest[fixed[2]:]
+	sealed := make([]byte, ChunkSize+aead.Overhead())
+	plaintext := make([]byte, 0, ChunkSize)
+
+	var total int64
+
+	for counter := uint32(0); ; counter++ {
+		n, err := io.ReadFull(br, sealed)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			// Running out before a last chunk means the stream was cut short.
+			if err == io.EOF {
+				return total, ErrMalformedCiphertext
+			}
+			return total, err
+		}
+
+		last := n < len(sealed)
+		if !last {
+			if _, err := br.Peek(1); err == io.EOF {
+				last = true
+			} else if err != nil {
+				return total, err
+			}
+		}
+
+		plaintext, err = aead.Open(plaintext[:0], chunkNonce(prefix, counter, last), sealed[:n], ad)
+		if err != nil {
+			return total, ErrTampered
+		}
+
+		if _, err := dst.Write(plaintext); err != nil {
+			return total, err
+		}
+		total += int64(len(plaintext))
+
+		if last {
+			return total, nil
+		}
+
+		if counter == math.MaxUint32 {
+			return total, ErrMalformedCiphertext
+		}
+	}
+}
+
+func chunkNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, streamNoncePrefix+5)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[streamNoncePrefix:], counter)
+
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+
+	return nonce
+}
@@ -0,0 +1,120 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+func newStreamKey(t *testing.T) *Key {
+	t.Helper()
+
+	key, err := NewKey("stream-1", bytes.Repeat([]byte{0x42}, KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+// encryptStream seals a random plaintext of size bytes and returns both.
+func encryptStream(t *testing.T, key *Key, size int) (plaintext, stream []byte) {
+	t.Helper()
+
+	plaintext = make([]byte, size)
+	if _, err := rand.Read(plaintext); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+
+	n, err := key.EncryptStream(&buf, bytes.NewReader(plaintext), []byte("ad"))
+	if err != nil {
+		t.Fatalf("EncryptStream: %v", err)
+	}
+
+	if n != int64(size) {
+		t.Fatalf("EncryptStream read %d bytes, want %d", n, size)
+	}
+
+	return plaintext, buf.Bytes()
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	key := newStreamKey(t)
+
+	for _, size := range []int{0, 1, ChunkSize - 1, ChunkSize, ChunkSize + 1, 3*ChunkSize + 5} {
+		plaintext, stream := encryptStream(t, key, size)
+
+		var out bytes.Buffer
+
+		n, err := key.DecryptStream(&out, bytes.NewReader(stream), []byte("ad"))
+		if err != nil {
+			t.Errorf("size %d: DecryptStream: %v", size, err)
+			continue
+		}
+
+		if n != int64(size) || !bytes.Equal(out.Bytes(), plaintext) {
+			t.Errorf("size %d: got %d bytes back, which don't match the plaintext", size, n)
+		}
+	}
+}
+
+func TestStreamTampering(t *testing.T) {
+	key := newStreamKey(t)
+
+	_, stream := encryptStream(t, key, 3*ChunkSize+5)
+
+	header := 3 + len(key.ID) + streamNoncePrefix
+	chunk := ChunkSize + 16
+
+	chunkAt := func(i int) []byte {
+		return stream[header+i*chunk : header+(i+1)*chunk]
+	}
+
+	// The chunks of the stream in another order.
+	reordered := append([]byte{}, stream[:header]...)
+	reordered = append(reordered, chunkAt(1)...)
+	reordered = append(reordered, chunkAt(0)...)
+	reordered = append(reordered, stream[header+2*chunk:]...)
+
+	tests := []struct {
+		name   string
+		stream []byte
+		ad     string
+		want   error
+	}{
+		{"last chunk dropped", stream[:header+3*chunk], "ad", ErrTampered},
+		{"cut in a chunk", stream[:header+chunk+100], "ad", ErrTampered},
+		{"cut after the header", stream[:header], "ad", ErrMalformedCiphertext},
+		{"cut in the header", stream[:header-1], "ad", ErrMalformedCiphertext},
+		{"chunks reordered", reordered, "ad", ErrTampered},
+		{"other additional data", stream, "other", ErrTampered},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+
+		_, err := key.DecryptStream(&out, bytes.NewReader(tt.stream), []byte(tt.ad))
+		if err != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestStreamWrongKey(t *testing.T) {
+	key := newStreamKey(t)
+
+	_, stream := encryptStream(t, key, 10)
+
+	other, err := NewKey("stream-2", bytes.Repeat([]byte{0x42}, KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+
+	if _, err := other.DecryptStream(&out, bytes.NewReader(stream), []byte("ad")); err != ErrUnknownKey {
+		t.Errorf("got %v, want ErrUnknownKey", err)
+	}
+}
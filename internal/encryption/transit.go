@@ -0,0 +1,125 @@
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// TransitKeyProvider unwraps the key through a Vault-style transit engine. The
+// key is only ever stored wrapped (as returned by Wrap), and the transit
+// server decrypts it at startup so the plaintext key never touches disk.
+//
+// The server must implement:
+//
+//	POST {Addr}/v1/{Mount}/encrypt/{KeyName}  {"plaintext": "<base64>"}  -> {"data": {"ciphertext": "..."}}
+//	POST {Addr}/v1/{Mount}/decrypt/{KeyName}  {"ciphertext": "..."}      -> {"data": {"plaintext": "<base64>"}}
+//
+// authenticated with an X-Vault-Token header.
+type TransitKeyProvider struct {
+	ID         string
+	Addr       string
+	Mount      string
+	KeyName    string
+	Token      string
+	WrappedKey string
+	Client     *http.Client
+}
+
+func (p TransitKeyProvider) Key(ctx context.Context) (*Key, error) {
+	if p.WrappedKey == "" {
+		return nil, fmt.Errorf("encryption: no wrapped key configured for transit key %q", p.KeyName)
+	}
+
+	var resp struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}
+
+	err := p.do(ctx, "decrypt", map[string]string{"ciphertext": p.WrappedKey}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	material, err := base64.StdEncoding.DecodeString(resp.Data.Plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("encryption: transit returned invalid plaintext: %w", err)
+	}
+
+	return NewKey(p.ID, material)
+}
+
+// Wrap encrypts key material with the transit engine, returning the value to
+// configure as WrappedKey.
+func (p TransitKeyProvider) Wrap(ctx context.Context, material []byte) (string, error) {
+	var resp struct {
+		Data struct {
+			Ciphertext string `json:"ciphertext"`
+		} `json:"data"`
+	}
+
+	body := map[string]string{"plaintext": base64.StdEncoding.EncodeToString(material)}
+
+	err := p.do(ctx, "encrypt", body, &resp)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.Data.Ciphertext == "" {
+		return "", fmt.Errorf("encryption: transit returned an empty ciphertext")
+	}
+
+	return resp.Data.Ciphertext, nil
+}
+
+func (p TransitKeyProvider) do(ctx context.Context, op string, body interface{}, dst interface{}) error {
+	mount := p.Mount
+	if mount == "" {
+		mount = "transit"
+	}
+
+	endpoint := fmt.Sprintf("%s/v1/%s/%s/%s", strings.TrimRight(p.Addr, "/"), mount, op, url.PathEscape(p.KeyName))
+
+	js, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(js))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Vault-Token", p.Token)
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("encryption: transit %s: %w", op, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("encryption: transit %s: unexpected status %d: %s", op, res.StatusCode, bytes.TrimSpace(msg))
+	}
+
+	err = json.NewDecoder(io.LimitReader(res.Body, 1_048_576)).Decode(dst)
+	if err != nil {
+		return fmt.Errorf("encryption: transit %s: %w", op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,170 @@
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTransitStub returns a server that behaves like a transit engine with a
+// single key named "passman". Its "ciphertext" is the plaintext with a
+// prefix, which is all a client can tell apart anyway.
+func newTransitStub(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if r.Header.Get("X-Vault-Token") != "s.token" {
+			http.Error(w, "permission denied", http.StatusForbidden)
+			return
+		}
+
+		var body map[string]string
+
+		err := json.NewDecoder(r.Body).Decode(&body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var data map[string]string
+
+		switch r.URL.Path {
+		case "/v1/transit/encrypt/passman":
+			data = map[string]string{"ciphertext": "vault:v1:" + body["plaintext"]}
+		case "/v1/transit/decrypt/passman":
+			if !strings.HasPrefix(body["ciphertext"], "vault:v1:") {
+				http.Error(w, "invalid ciphertext", http.StatusBadRequest)
+				return
+			}
+			data = map[string]string{"plaintext": strings.TrimPrefix(body["ciphertext"], "vault:v1:")}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}))
+
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestTransitKeyProviderRoundTrip(t *testing.T) {
+	srv := newTransitStub(t)
+
+	p := TransitKeyProvider{ID: "transit-1", Addr: srv.URL + "/", KeyName: "passman", Token: "s.token"}
+
+	material := bytes.Repeat([]byte{0x42}, KeySize)
+
+	wrapped, err := p.Wrap(context.Background(), material)
+	if err != nil {
+		t.Fatalf("Wrap: %v", err)
+	}
+
+	p.WrappedKey = wrapped
+
+	key, err := p.Key(context.Background())
+	if err != nil {
+		t.Fatalf("Key: %v", err)
+	}
+
+	if key.ID != "transit-1" {
+		t.Errorf("got key ID %q, want %q", key.ID, "transit-1")
+	}
+
+	if !bytes.Equal(key.material, material) {
+		t.Errorf("got key material %x, want %x", key.material, material)
+	}
+}
+
+func TestTransitKeyProviderErrors(t *testing.T) {
+	srv := newTransitStub(t)
+
+	tests := []struct {
+		name     string
+		provider TransitKeyProvider
+		want     string
+	}{
+		{
+			name:     "no wrapped key",
+			provider: TransitKeyProvider{ID: "k", Addr: srv.URL, KeyName: "passman", Token: "s.token"},
+			want:     "no wrapped key configured",
+		},
+		{
+			name:     "bad token",
+			provider: TransitKeyProvider{ID: "k", Addr: srv.URL, KeyName: "passman", Token: "wrong", WrappedKey: "vault:v1:AAAA"},
+			want:     "unexpected status 403: permission denied",
+		},
+		{
+			name:     "unknown key",
+			provider: TransitKeyProvider{ID: "k", Addr: srv.URL, KeyName: "other", Token: "s.token", WrappedKey: "vault:v1:AAAA"},
+			want:     "unexpected status 404",
+		},
+		{
+			name:     "plaintext not base64",
+			provider: TransitKeyProvider{ID: "k", Addr: srv.URL, KeyName: "passman", Token: "s.token", WrappedKey: "vault:v1:not base64!"},
+			want:     "transit returned invalid plaintext",
+		},
+		{
+			name:     "wrong key size",
+			provider: TransitKeyProvider{ID: "k", Addr: srv.URL, KeyName: "passman", Token: "s.token", WrappedKey: "vault:v1:AAAA"},
+			want:     ErrInvalidKey.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.provider.Key(context.Background())
+			if err == nil {
+				t.Fatalf("got no error, want one containing %q", tt.want)
+			}
+
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %q, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransitKeyProviderMalformedResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data": {"plaintext": `))
+	}))
+	defer srv.Close()
+
+	p := TransitKeyProvider{ID: "k", Addr: srv.URL, KeyName: "passman", WrappedKey: "vault:v1:AAAA"}
+
+	_, err := p.Key(context.Background())
+	if err == nil || !strings.HasPrefix(err.Error(), "encryption: transit decrypt:") {
+		t.Errorf("got error %v, want a transit decrypt error", err)
+	}
+
+	_, err = p.Wrap(context.Background(), make([]byte, KeySize))
+	if err == nil || !strings.HasPrefix(err.Error(), "encryption: transit encrypt:") {
+		t.Errorf("got error %v, want a transit encrypt error", err)
+	}
+}
+
+func TestTransitKeyProviderEmptyCiphertext(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data": {}}`))
+	}))
+	defer srv.Close()
+
+	p := TransitKeyProvider{ID: "k", Addr: srv.URL, KeyName: "passman"}
+
+	_, err := p.Wrap(context.Background(), make([]byte, KeySize))
+	if err == nil || !strings.Contains(err.Error(), "empty ciphertext") {
+		t.Errorf("got error %v, want an empty ciphertext error", err)
+	}
+}
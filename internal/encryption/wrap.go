@@ -0,0 +1,73 @@
+package encryption
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"io"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/hkdf"
+)
+
+// GenerateKey returns a new random key.
+func GenerateKey(id string) (*Key, error) {
+	material := make([]byte, KeySize)
+
+	_, err := rand.Read(material)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewKey(id, material)
+}
+
+// Argon2Params are the cost parameters for deriving a key from a passphrase.
+type Argon2Params struct {
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+}
+
+// DefaultArgon2Params are used wherever a key is derived from a human chosen
+// secret. Changing them changes every derived key, so existing keys must be
+// rewrapped before they can be changed.
+var DefaultArgon2Params = Argon2Params{
+	Time:    DefaultArgon2Time,
+	Memory:  DefaultArgon2Memory,
+	Threads: DefaultArgon2Threads,
+}
+
+// DeriveKey derives a key from a passphrase and salt with Argon2id.
+func DeriveKey(id string, passphrase, salt []byte, params Argon2Params) (*Key, error) {
+	material := argon2.IDKey(passphrase, salt, params.Time, params.Memory, params.Threads, KeySize)
+	return NewKey(id, material)
+}
+
+// ExpandKey derives a key from a secret that already has high entropy, such as
+// a random token, with HKDF-SHA256.
+func ExpandKey(id string, secret, info []byte) (*Key, error) {
+	material := make([]byte, KeySize)
+
+	_, err := io.ReadFull(hkdf.New(sha256.New, secret, nil, info), material)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewKey(id, material)
+}
+
+// WrapKey seals key with kek so that it can be stored alongside the data it
+// protects.
+func WrapKey(kek, key *Key, additionalData []byte) ([]byte, error) {
+	return kek.Encrypt(key.material, additionalData)
+}
+
+// UnwrapKey opens a key sealed by WrapKey and gives it the provided ID.
+func UnwrapKey(kek *Key, id string, wrapped, additionalData []byte) (*Key, error) {
+	material, err := kek.Decrypt(wrapped, additionalData)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewKey(id, material)
+}
@@ -0,0 +1,79 @@
+//go:build ignore
+// +build ignore
+
+// gen.go turns a copy of the EFF large wordlist into wordlist.go. Run it from
+// this directory with the path of the list as published at
+// https://www.eff.org/files/2016/07/18/eff_large_wordlist.txt:
+//
+//	go run gen.go -input eff_large_wordlist.txt
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+)
+
+func main() {
+	input := flag.String("input", "eff_large_wordlist.txt", "Wordlist to read")
+	flag.Parse()
+
+	f, err := os.Open(*input)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	var words []string
+	seen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Each line is a dice roll followed by its word.
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+
+		word := strings.ToLower(fields[1])
+		if strings.Contains(word, "`") {
+			log.Fatalf("word %q can't be written into a raw string", word)
+		}
+		if seen[word] {
+			log.Fatalf("word %q is listed twice", word)
+		}
+
+		seen[word] = true
+		words = append(words, word)
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "// Code generated by gen.go; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "// The EFF large wordlist is published by the Electronic Frontier\n")
+	fmt.Fprintf(&buf, "// Foundation under the Creative Commons Attribution 3.0 United States\n")
+	fmt.Fprintf(&buf, "// License: https://creativecommons.org/licenses/by/3.0/us/.\n\n")
+	fmt.Fprintf(&buf, "package generator\n\n")
+	fmt.Fprintf(&buf, "// wordlist holds the %d words of the EFF large wordlist, one per line.\n", len(words))
+	fmt.Fprintf(&buf, "const wordlist = `%s`\n", strings.Join(words, "\n"))
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = ioutil.WriteFile("wordlist.go", src, 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,323 @@
+// Package generator makes random passwords and passphrases. Every choice is
+// drawn from crypto/rand, and passphrases are built from the EFF large
+// wordlist, compiled into the binary by gen.go.
+package generator
+
+import (
+	"crypto/rand"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/robihdy/passman/internal/validator"
+)
+
+const (
+	TypePassword   = "password"
+	TypePassphrase = "passphrase"
+)
+
+// Character classes of a password. Symbols leave out quotes, backslashes and
+// spaces, which are easy to get wrong when a password is pasted into a shell
+// or a config file.
+const (
+	lowercase = "abcdefghijklmnopqrstuvwxyz"
+	uppercase = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	digits    = "0123456789"
+	symbols   = "!#$%&()*+,-./:;<=>?@[]^_{|}~"
+
+	// ambiguous characters are easily mistaken for one another when read.
+	ambiguous = "0Oo1lI|"
+)
+
+const (
+	defaultLength = 20
+	minLength     = 4
+	maxLength     = 128
+
+	defaultWords = 6
+	minWords     = 3
+	maxWords     = 20
+
+	defaultSeparator = "-"
+	maxSeparator     = 5
+)
+
+// Options describe what to generate. The zero value gives a 20 character
+// password using every character class. Each class that is used appears at
+// least once, or as many times as its minimum if that is higher.
+//
+// Passphrases are a number of words joined by Separator, optionally
+// capitalized and with a digit added to one of the words.
+type Options struct {
+	Type string `json:"type"`
+
+	Length           int   `json:"length"`
+	Lowercase        *bool `json:"lowercase"`
+	Uppercase        *bool `json:"uppercase"`
+	Digits           *bool `json:"digits"`
+	Symbols          *bool `json:"symbols"`
+	ExcludeAmbiguous bool  `json:"exclude_ambiguous"`
+	MinLowercase     int   `json:"min_lowercase"`
+	MinUppercase     int   `json:"min_uppercase"`
+	MinDigits        int   `json:"min_digits"`
+	MinSymbols       int   `json:"min_symbols"`
+
+	Words         int     `json:"words"`
+	Separator     *string `json:"separator"`
+	Capitalize    bool    `json:"capitalize"`
+	IncludeNumber bool    `json:"include_number"`
+}
+
+// class is one character class of a password and the minimum count asked
+// for.
+type class struct {
+	name    string
+	chars   string
+	enabled bool
+	min     int
+}
+
+// required returns how many characters of the class a password must have.
+func (c class) required() int {
+	if c.enabled && c.min < 1 {
+		return 1
+	}
+
+	return c.min
+}
+
+func (o *Options) classes() []class {
+	classes := []class{
+		{"lowercase", lowercase, enabled(o.Lowercase), o.MinLowercase},
+		{"uppercase", uppercase, enabled(o.Uppercase), o.MinUppercase},
+		{"digits", digits, enabled(o.Digits), o.MinDigits},
+		{"symbols", symbols, enabled(o.Symbols), o.MinSymbols},
+	}
+
+	if o.ExcludeAmbiguous {
+		for i := range classes {
+			classes[i].chars = strings.Map(func(r rune) rune {
+				if strings.ContainsRune(ambiguous, r) {
+					return -1
+				}
+				return r
+			}, classes[i].chars)
+		}
+	}
+
+	return classes
+}
+
+// enabled treats a class that isn't mentioned as wanted.
+func enabled(b *bool) bool {
+	return b == nil || *b
+}
+
+func (o *Options) setDefaults() {
+	if o.Type == "" {
+		o.Type = TypePassword
+	}
+	if o.Length == 0 {
+		o.Length = defaultLength
+	}
+	if o.Words == 0 {
+		o.Words = defaultWords
+	}
+	if o.Separator == nil {
+		separator := defaultSeparator
+		o.Separator = &separator
+	}
+}
+
+// ValidateOptions fills in the defaults of o and checks what is left.
+func ValidateOptions(v *validator.Validator, o *Options) {
+	o.setDefaults()
+
+	v.Check(validator.In(o.Type, TypePassword, TypePassphrase), "type", "must be password or passphrase")
+
+	if o.Type == TypePassphrase {
+		v.Check(o.Words >= minWords, "words", "must be at least 3")
+		v.Check(o.Words <= maxWords, "words", "must not be more than 20")
+		v.Check(len(*o.Separator) <= maxSeparator, "separator", "must not be more than 5 bytes long")
+		return
+	}
+
+	v.Check(o.Length >= minLength, "length", "must be at least 4")
+	v.Check(o.Length <= maxLength, "length", "must not be more than 128")
+
+	required := 0
+	used := false
+
+	for _, c := range o.classes() {
+		v.Check(c.min >= 0, "min_"+c.name, "must not be negative")
+
+		if !c.enabled {
+			v.Check(c.min == 0, "min_"+c.name, "must not be set when "+c.name+" is false")
+			continue
+		}
+
+		used = true
+		required += c.required()
+	}
+
+	v.Check(used, "type", "must use at least one character class")
+	v.Check(required <= o.Length, "length", "must be at least the sum of the minimum counts")
+}
+
+// Generate returns a new password or passphrase as o describes. The options
+// are expected to have passed ValidateOptions.
+func Generate(o Options) (string, error) {
+	o.setDefaults()
+
+	if o.Type == TypePassphrase {
+		return passphrase(o)
+	}
+
+	return password(o)
+}
+
+func password(o Options) (string, error) {
+	var (
+		chars []byte
+		pool  string
+	)
+
+	// Draw each class's minimum from the class itself and the rest from
+	// every class in use, then shuffle so the required characters don't
+	// always come first.
+	for _, c := range o.classes() {
+		if !c.enabled {
+			continue
+		}
+
+		for i := 0; i < c.required(); i++ {
+			ch, err := pick(c.chars)
+			if err != nil {
+				return "", err
+			}
+			chars = append(chars, ch)
+		}
+
+		pool += c.chars
+	}
+
+	for len(chars) < o.Length {
+		ch, err := pick(pool)
+		if err != nil {
+			return "", err
+		}
+		chars = append(chars, ch)
+	}
+
+	for i := len(chars) - 1; i > 0; i-- {
+		j, err := randInt(i + 1)
+		if err != nil {
+			return "", err
+		}
+		chars[i], chars[j] = chars[j], chars[i]
+	}
+
+	return string(chars), nil
+}
+
+var (
+	loadWords sync.Once
+	words     []string
+
+	// The lengths of the shortest and longest words on the list.
+	shortestWord, longestWord int
+)
+
+func loadWordlist() {
+	loadWords.Do(func() {
+		words = strings.Split(wordlist, "\n")
+
+		shortestWord = len(words[0])
+
+		for _, word := range words {
+			if len(word) < shortestWord {
+				shortestWord = len(word)
+			}
+			if len(word) > longestWord {
+				longestWord = len(word)
+			}
+		}
+	})
+}
+
+// LengthRange returns the fewest and the most bytes what o describes can
+// come out as. A password always has its length, but a passphrase depends on
+// the words that are drawn. The options are expected to have passed
+// ValidateOptions.
+func LengthRange(o Options) (int, int) {
+	o.setDefaults()
+
+	if o.Type != TypePassphrase {
+		return o.Length, o.Length
+	}
+
+	loadWordlist()
+
+	fixed := (o.Words - 1) * len(*o.Separator)
+	if o.IncludeNumber {
+		fixed++
+	}
+
+	return o.Words*shortestWord + fixed, o.Words*longestWord + fixed
+}
+
+func passphrase(o Options) (string, error) {
+	loadWordlist()
+
+	chosen := make([]string, o.Words)
+
+	for i := range chosen {
+		n, err := randInt(len(words))
+		if err != nil {
+			return "", err
+		}
+
+		chosen[i] = words[n]
+
+		if o.Capitalize {
+			chosen[i] = strings.ToUpper(chosen[i][:1]) + chosen[i][1:]
+		}
+	}
+
+	if o.IncludeNumber {
+		i, err := randInt(len(chosen))
+		if err != nil {
+			return "", err
+		}
+
+		d, err := pick(digits)
+		if err != nil {
+			return "", err
+		}
+
+		chosen[i] += string(d)
+	}
+
+	return strings.Join(chosen, *o.Separator), nil
+}
+
+// pick returns a character of chars chosen uniformly at random.
+func pick(chars string) (byte, error) {
+	i, err := randInt(len(chars))
+	if err != nil {
+		return 0, err
+	}
+
+	return chars[i], nil
+}
+
+// randInt returns a uniformly random int in [0, n).
+func randInt(n int) (int, error) {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+
+	return int(i.Int64()), nil
+}
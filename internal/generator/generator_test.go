@@ -0,0 +1,211 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/robihdy/passman/internal/validator"
+)
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func count(s, chars string) int {
+	n := 0
+
+	for _, c := range s {
+		if strings.ContainsRune(chars, c) {
+			n++
+		}
+	}
+
+	return n
+}
+
+func TestPasswordDefaults(t *testing.T) {
+	var o Options
+
+	v := validator.New()
+	if ValidateOptions(v, &o); !v.Valid() {
+		t.Fatalf("default options are invalid: %v", v.Errors)
+	}
+
+	for i := 0; i < 100; i++ {
+		password, err := Generate(o)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(password) != defaultLength {
+			t.Fatalf("got %q, want %d characters", password, defaultLength)
+		}
+
+		for _, chars := range []string{lowercase, uppercase, digits, symbols} {
+			if count(password, chars) == 0 {
+				t.Fatalf("%q has none of %q", password, chars)
+			}
+		}
+	}
+}
+
+func TestPasswordMinimums(t *testing.T) {
+	o := Options{
+		Length:       12,
+		Symbols:      boolPtr(false),
+		MinLowercase: 2,
+		MinUppercase: 3,
+		MinDigits:    5,
+	}
+
+	v := validator.New()
+	if ValidateOptions(v, &o); !v.Valid() {
+		t.Fatalf("options are invalid: %v", v.Errors)
+	}
+
+	for i := 0; i < 100; i++ {
+		password, err := Generate(o)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		switch {
+		case len(password) != 12:
+			t.Fatalf("got %q, want 12 characters", password)
+		case count(password, lowercase) < 2:
+			t.Fatalf("%q has fewer than 2 lowercase letters", password)
+		case count(password, uppercase) < 3:
+			t.Fatalf("%q has fewer than 3 uppercase letters", password)
+		case count(password, digits) < 5:
+			t.Fatalf("%q has fewer than 5 digits", password)
+		case count(password, symbols) > 0:
+			t.Fatalf("%q has symbols", password)
+		}
+	}
+}
+
+func TestPasswordExcludeAmbiguous(t *testing.T) {
+	o := Options{Length: maxLength, ExcludeAmbiguous: true}
+
+	v := validator.New()
+	if ValidateOptions(v, &o); !v.Valid() {
+		t.Fatalf("options are invalid: %v", v.Errors)
+	}
+
+	for i := 0; i < 100; i++ {
+		password, err := Generate(o)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.ContainsAny(password, ambiguous) {
+			t.Fatalf("%q has ambiguous characters", password)
+		}
+	}
+}
+
+func TestPassphrase(t *testing.T) {
+	separator := "_"
+	o := Options{Type: TypePassphrase, Words: 5, Separator: &separator, Capitalize: true, IncludeNumber: true}
+
+	v := validator.New()
+	if ValidateOptions(v, &o); !v.Valid() {
+		t.Fatalf("options are invalid: %v", v.Errors)
+	}
+
+	passphrase, err := Generate(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chosen := strings.Split(passphrase, separator)
+	if len(chosen) != 5 {
+		t.Fatalf("got %q, want 5 words", passphrase)
+	}
+
+	if count(passphrase, digits) != 1 {
+		t.Errorf("%q should have exactly one digit", passphrase)
+	}
+
+	for _, word := range chosen {
+		if word[0] < 'A' || word[0] > 'Z' {
+			t.Errorf("%q of %q is not capitalized", word, passphrase)
+		}
+
+		word = strings.ToLower(strings.TrimRight(word, digits))
+		if !strings.Contains("\n"+wordlist+"\n", "\n"+word+"\n") {
+			t.Errorf("%q of %q is not in the wordlist", word, passphrase)
+		}
+	}
+}
+
+func TestLengthRange(t *testing.T) {
+	separator := "--"
+
+	tests := []struct {
+		o                 Options
+		shortest, longest int
+	}{
+		{Options{}, defaultLength, defaultLength},
+		{Options{Length: 8}, 8, 8},
+		{Options{Type: TypePassphrase, Words: 3}, 3*3 + 2, 3*9 + 2},
+		{Options{Type: TypePassphrase, Words: 4, Separator: &separator, IncludeNumber: true}, 4*3 + 6 + 1, 4*9 + 6 + 1},
+	}
+
+	for _, tt := range tests {
+		shortest, longest := LengthRange(tt.o)
+		if shortest != tt.shortest || longest != tt.longest {
+			t.Errorf("LengthRange(%+v) = %d, %d; want %d, %d", tt.o, shortest, longest, tt.shortest, tt.longest)
+		}
+	}
+
+	// Whatever is drawn falls in the range.
+	o := Options{Type: TypePassphrase, Words: 5, IncludeNumber: true}
+	shortest, longest := LengthRange(o)
+
+	for i := 0; i < 100; i++ {
+		passphrase, err := Generate(o)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(passphrase) < shortest || len(passphrase) > longest {
+			t.Fatalf("%q is %d bytes long, outside %d to %d", passphrase, len(passphrase), shortest, longest)
+		}
+	}
+}
+
+func TestWordlist(t *testing.T) {
+	words := strings.Split(wordlist, "\n")
+
+	if len(words) != 7776 {
+		t.Errorf("wordlist has %d words, want 7776", len(words))
+	}
+}
+
+func TestValidateOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		o    Options
+		key  string
+	}{
+		{"unknown type", Options{Type: "pin"}, "type"},
+		{"too short", Options{Length: 3}, "length"},
+		{"too long", Options{Length: maxLength + 1}, "length"},
+		{"minimums over length", Options{Length: 8, MinDigits: 6, MinSymbols: 3}, "length"},
+		{"negative minimum", Options{MinDigits: -1}, "min_digits"},
+		{"minimum of unused class", Options{Symbols: boolPtr(false), MinSymbols: 1}, "min_symbols"},
+		{"no classes", Options{Lowercase: boolPtr(false), Uppercase: boolPtr(false), Digits: boolPtr(false), Symbols: boolPtr(false)}, "type"},
+		{"too few words", Options{Type: TypePassphrase, Words: 2}, "words"},
+		{"too many words", Options{Type: TypePassphrase, Words: maxWords + 1}, "words"},
+	}
+
+	for _, tt := range tests {
+		v := validator.New()
+		ValidateOptions(v, &tt.o)
+
+		if _, ok := v.Errors[tt.key]; !ok {
+			t.Errorf("%s: got errors %v, want one for %q", tt.name, v.Errors, tt.key)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+// Package notify delivers notifications meant for users, such as reminders
+// that a password is due to be rotated. Where they go is up to the Notifier
+// the server is configured with.
+package notify
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/robihdy/passman/internal/jsonlog"
+)
+
+// Notification is something a user should be told about. Details carry the
+// specifics of the event, such as which login it concerns.
+type Notification struct {
+	Event   string            `json:"event"`
+	UserID  int64             `json:"user_id"`
+	Email   string            `json:"email"`
+	Message string            `json:"message"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// Notifier delivers notifications. A notification that fails to be delivered
+// is tried again later, so Notify may see the same one more than once.
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// LogNotifier writes notifications to the server log, for deployments where
+// something else picks them up from there.
+type LogNotifier struct {
+	Logger *jsonlog.Logger
+}
+
+func (n LogNotifier) Notify(ctx context.Context, notification Notification) error {
+	properties := map[string]string{
+		"event":   notification.Event,
+		"user_id": strconv.FormatInt(notification.UserID, 10),
+		"email":   notification.Email,
+	}
+
+	for k, v := range notification.Details {
+		properties[k] = v
+	}
+
+	n.Logger.PrintInfo(notification.Message, properties)
+	return nil
+}
+
+// NopNotifier drops every notification.
+type NopNotifier struct{}
+
+func (NopNotifier) Notify(ctx context.Context, n Notification) error {
+	return nil
+}
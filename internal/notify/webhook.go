@@ -0,0 +1,68 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// WebhookNotifier POSTs each notification as JSON to URL. If Secret is set
+// the body is signed with HMAC-SHA256 and the hex-encoded signature sent in
+// the X-Passman-Signature header, so the receiver can check where it came
+// from.
+type WebhookNotifier struct {
+	URL    string
+	Secret []byte
+	Client *http.Client
+}
+
+func (n WebhookNotifier) Notify(ctx context.Context, notification Notification) error {
+	body, err := json.Marshal(struct {
+		Notification
+		Time time.Time `json:"time"`
+	}{notification, time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if len(n.Secret) > 0 {
+		mac := hmac.New(sha256.New, n.Secret)
+		mac.Write(body)
+		req.Header.Set("X-Passman-Signature", hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	client := n.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Drain the body so the connection can be reused.
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("notify: webhook responded with %s", resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+//go:build ignore
+// +build ignore
+
+// gen.go turns a copy of the Public Suffix List into list.go. Run it from
+// this directory with the path of a freshly downloaded list:
+//
+//	go run gen.go -input public_suffix_list.dat -version 2023-02-09
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+)
+
+func main() {
+	input := flag.String("input", "public_suffix_list.dat", "Public Suffix List to read")
+	version := flag.String("version", "", "Date or version of the list, recorded in list.go")
+	flag.Parse()
+
+	f, err := os.Open(*input)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	var rules []string
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Each rule is the first word of its line.
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "//") {
+			continue
+		}
+
+		rule := strings.ToLower(fields[0])
+		if strings.Contains(rule, "`") {
+			log.Fatalf("rule %q can't be written into a raw string", rule)
+		}
+
+		rules = append(rules, rule)
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "// Code generated by gen.go; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "// The Public Suffix List is subject to the terms of the Mozilla Public\n")
+	fmt.Fprintf(&buf, "// License, v. 2.0. If a copy of the MPL was not distributed with this\n")
+	fmt.Fprintf(&buf, "// file, You can obtain one at https://mozilla.org/MPL/2.0/.\n\n")
+	fmt.Fprintf(&buf, "package publicsuffix\n\n")
+	fmt.Fprintf(&buf, "// Version identifies the snapshot of the list.\n")
+	fmt.Fprintf(&buf, "const Version = %q\n\n", *version)
+	fmt.Fprintf(&buf, "// list holds the %d rules of the snapshot, ICANN and private, one per line.\n", len(rules))
+	fmt.Fprintf(&buf, "const list = `%s`\n", strings.Join(rules, "\n"))
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = ioutil.WriteFile("list.go", src, 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,118 @@
+// Package publicsuffix finds the registrable domain of a host name using a
+// snapshot of the Public Suffix List (https://publicsuffix.org/) compiled into
+// the binary, so lookups never touch the network. The snapshot is refreshed by
+// running gen.go.
+package publicsuffix
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+var ErrPublicSuffix = errors.New("publicsuffix: domain is a public suffix")
+
+type ruleKind int
+
+const (
+	ruleNormal ruleKind = iota + 1
+	ruleWildcard
+	ruleException
+)
+
+var (
+	loadRules sync.Once
+	rules     map[string]ruleKind
+)
+
+// parseRules indexes the list by the domain each rule is written for. A
+// wildcard rule "*.ck" is kept under "ck" and an exception "!www.ck" under
+// "www.ck".
+func parseRules() {
+	lines := strings.Split(list, "\n")
+	rules = make(map[string]ruleKind, len(lines))
+
+	for _, rule := range lines {
+		switch {
+		case strings.HasPrefix(rule, "*."):
+			rules[rule[2:]] = ruleWildcard
+		case strings.HasPrefix(rule, "!"):
+			rules[rule[1:]] = ruleException
+		default:
+			// A domain can be listed both as a suffix and as the parent
+			// of a wildcard; the wildcard covers both.
+			if rules[rule] != ruleWildcard {
+				rules[rule] = ruleNormal
+			}
+		}
+	}
+}
+
+// PublicSuffix returns the public suffix of domain, such as "co.uk" for
+// "www.example.co.uk". A domain no rule covers is treated as having its last
+// label as its suffix, as the list prescribes. Labels in punycode are looked
+// up in their Unicode form.
+func PublicSuffix(domain string) string {
+	loadRules.Do(parseRules)
+
+	labels := strings.Split(normalize(domain), ".")
+
+	for i := range labels {
+		candidate := strings.Join(labels[i:], ".")
+
+		switch rules[candidate] {
+		case ruleException:
+			return strings.Join(labels[i+1:], ".")
+		case ruleNormal, ruleWildcard:
+			return candidate
+		}
+
+		if i+1 < len(labels) && rules[strings.Join(labels[i+1:], ".")] == ruleWildcard {
+			return candidate
+		}
+	}
+
+	return labels[len(labels)-1]
+}
+
+// EffectiveTLDPlusOne returns the registrable domain of domain: its public
+// suffix and one more label, such as "example.co.uk" for
+// "www.example.co.uk". It fails with ErrPublicSuffix if domain is itself a
+// public suffix.
+func EffectiveTLDPlusOne(domain string) (string, error) {
+	domain = normalize(domain)
+	if domain == "" {
+		return "", ErrPublicSuffix
+	}
+
+	suffix := PublicSuffix(domain)
+	if len(domain) <= len(suffix) {
+		return "", ErrPublicSuffix
+	}
+
+	rest := domain[:len(domain)-len(suffix)-1]
+
+	return rest[strings.LastIndex(rest, ".")+1:] + "." + suffix, nil
+}
+
+// normalize lowercases domain, drops a trailing dot and decodes punycode
+// labels so they compare equal to the Unicode rules of the list. A label that
+// isn't valid punycode is left alone.
+func normalize(domain string) string {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+
+	if !strings.Contains(domain, "xn--") {
+		return domain
+	}
+
+	labels := strings.Split(domain, ".")
+	for i, label := range labels {
+		if strings.HasPrefix(label, "xn--") {
+			if decoded, err := decodePunycode(label[4:]); err == nil {
+				labels[i] = decoded
+			}
+		}
+	}
+
+	return strings.Join(labels, ".")
+}
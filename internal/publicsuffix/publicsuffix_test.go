@@ -0,0 +1,93 @@
+package publicsuffix
+
+import "testing"
+
+func TestEffectiveTLDPlusOne(t *testing.T) {
+	tests := []struct {
+		domain string
+		want   string // empty for ErrPublicSuffix
+	}{
+		{"", ""},
+		{"com", ""},
+		{"example.com", "example.com"},
+		{"www.example.com", "example.com"},
+		{"WWW.Example.COM.", "example.com"},
+		{"www.example.co.uk", "example.co.uk"},
+		{"co.uk", ""},
+
+		// Unlisted TLDs count as public suffixes.
+		{"example", ""},
+		{"example.example", "example.example"},
+		{"b.example.example", "example.example"},
+
+		// Private section of the list.
+		{"github.io", ""},
+		{"foo.github.io", "foo.github.io"},
+		{"www.foo.github.io", "foo.github.io"},
+
+		// Wildcard "*.ck" with exception "!www.ck".
+		{"ck", ""},
+		{"test.ck", ""},
+		{"b.test.ck", "b.test.ck"},
+		{"a.b.test.ck", "b.test.ck"},
+		{"www.ck", "www.ck"},
+		{"www.www.ck", "www.ck"},
+
+		// Wildcard "*.kawasaki.jp" with exception "!city.kawasaki.jp".
+		{"test.kawasaki.jp", ""},
+		{"b.test.kawasaki.jp", "b.test.kawasaki.jp"},
+		{"city.kawasaki.jp", "city.kawasaki.jp"},
+		{"www.city.kawasaki.jp", "city.kawasaki.jp"},
+
+		// Unicode rules, matched in either form.
+		{"公司.cn", ""},
+		{"食狮.公司.cn", "食狮.公司.cn"},
+		{"www.食狮.公司.cn", "食狮.公司.cn"},
+		{"xn--55qx5d.cn", ""},
+		{"xn--85x722f.xn--55qx5d.cn", "食狮.公司.cn"},
+		{"www.xn--85x722f.xn--fiqs8s", "食狮.中国"},
+		{"xn--fiqs8s", ""},
+	}
+
+	for _, tt := range tests {
+		got, err := EffectiveTLDPlusOne(tt.domain)
+
+		if tt.want == "" {
+			if err != ErrPublicSuffix {
+				t.Errorf("EffectiveTLDPlusOne(%q) = %q, %v; want ErrPublicSuffix", tt.domain, got, err)
+			}
+			continue
+		}
+
+		if err != nil || got != tt.want {
+			t.Errorf("EffectiveTLDPlusOne(%q) = %q, %v; want %q", tt.domain, got, err, tt.want)
+		}
+	}
+}
+
+func TestDecodePunycode(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"85x722f", "食狮"},
+		{"55qx5d", "公司"},
+		{"fiqs8s", "中国"},
+		{"bcher-kva", "bücher"},
+		// RFC 3492 section 7.1, sample (L).
+		{"3B-ww4c5e180e575a65lsy2b", "3年B組金八先生"},
+	}
+
+	for _, tt := range tests {
+		got, err := decodePunycode(tt.input)
+		if err != nil || got != tt.want {
+			t.Errorf("decodePunycode(%q) = %q, %v; want %q", tt.input, got, err, tt.want)
+		}
+	}
+
+	for _, input := range []string{"ü", "abc-9999999999"} {
+		if got, err := decodePunycode(input); err == nil {
+			t.Errorf("decodePunycode(%q) = %q; want an error", input, got)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package publicsuffix
+
+import (
+	"errors"
+	"math"
+	"strings"
+)
+
+var errInvalidPunycode = errors.New("publicsuffix: invalid punycode")
+
+// Bootstring parameters for punycode, from RFC 3492 section 5.
+const (
+	punyBase        = 36
+	punyTMin        = 1
+	punyTMax        = 26
+	punySkew        = 38
+	punyDamp        = 700
+	punyInitialBias = 72
+	punyInitialN    = 128
+)
+
+// decodePunycode decodes a label with its "xn--" prefix already removed, as
+// described in RFC 3492 section 6.2.
+func decodePunycode(s string) (string, error) {
+	var output []rune
+
+	pos := 0
+	if i := strings.LastIndex(s, "-"); i >= 0 {
+		for _, r := range s[:i] {
+			if r >= 0x80 {
+				return "", errInvalidPunycode
+			}
+			output = append(output, r)
+		}
+		pos = i + 1
+	}
+
+	n, bias, i := punyInitialN, punyInitialBias, 0
+
+	for pos < len(s) {
+		oldi, w := i, 1
+
+		for k := punyBase; ; k += punyBase {
+			if pos == len(s) {
+				return "", errInvalidPunycode
+			}
+
+			digit, ok := punyDigit(s[pos])
+			if !ok {
+				return "", errInvalidPunycode
+			}
+			pos++
+
+			if digit > (math.MaxInt32-i)/w {
+				return "", errInvalidPunycode
+			}
+			i += digit * w
+
+			t := k - bias
+			if t < punyTMin {
+				t = punyTMin
+			} else if t > punyTMax {
+				t = punyTMax
+			}
+
+			if digit < t {
+				break
+			}
+
+			if w > math.MaxInt32/(punyBase-t) {
+				return "", errInvalidPunycode
+			}
+			w *= punyBase - t
+		}
+
+		length := len(output) + 1
+		bias = punyAdapt(i-oldi, length, oldi == 0)
+
+		if i/length > math.MaxInt32-n {
+			return "", errInvalidPunycode
+		}
+		n += i / length
+		i %= length
+
+		if n > 0x10FFFF || (0xD800 <= n && n <= 0xDFFF) {
+			return "", errInvalidPunycode
+		}
+
+		output = append(output, 0)
+		copy(output[i+1:], output[i:])
+		output[i] = rune(n)
+		i++
+	}
+
+	return string(output), nil
+}
+
+func punyDigit(c byte) (int, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return int(c-'0') + 26, true
+	case 'a' <= c && c <= 'z':
+		return int(c - 'a'), true
+	case 'A' <= c && c <= 'Z':
+		return int(c - 'A'), true
+	default:
+		return 0, false
+	}
+}
+
+func punyAdapt(delta, numPoints int, first bool) int {
+	if first {
+		delta /= punyDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / numPoints
+
+	k := 0
+	for delta > ((punyBase-punyTMin)*punyTMax)/2 {
+		delta /= punyBase - punyTMin
+		k += punyBase
+	}
+
+	return k + (punyBase-punyTMin+1)*delta/(delta+punySkew)
+}
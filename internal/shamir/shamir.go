@@ -0,0 +1,170 @@
+package shamir
+
+import (
+	"crypto/rand"
+	"errors"
+)
+
+var (
+	ErrInvalidParameters = errors.New("shamir: threshold must be between 2 and the number of parts, which must be at most 255")
+	ErrInvalidShares     = errors.New("shamir: shares must all be the same length and have distinct x coordinates")
+)
+
+// Split divides secret into parts shares, any threshold of which can be passed
+// to Combine to recover it. Fewer than threshold shares reveal nothing about
+// the secret.
+//
+// Each share is the secret's length plus one byte: the evaluations of a random
+// polynomial over GF(2^8) for every secret byte, followed by the x coordinate
+// they were evaluated at.
+func Split(secret []byte, parts, threshold int) ([][]byte, error) {
+	if threshold < 2 || parts < threshold || parts > 255 {
+		return nil, ErrInvalidParameters
+	}
+
+	if len(secret) == 0 {
+		return nil, errors.New("shamir: secret must not be empty")
+	}
+
+	shares := make([][]byte, parts)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][len(secret)] = byte(i + 1)
+	}
+
+	coefficients := make([]byte, threshold)
+
+	for b, s := range secret {
+		// The constant term is the secret byte; the rest are random.
+		coefficients[0] = s
+		if _, err := rand.Read(coefficients[1:]); err != nil {
+			return nil, err
+		}
+
+		for i := range shares {
+			shares[i][b] = evaluate(coefficients, byte(i+1))
+		}
+	}
+
+	return shares, nil
+}
+
+// Combine recovers the secret from at least threshold shares produced by
+// Split. Passing fewer shares, or shares from different splits, returns a
+// wrong secret rather than an error, so callers must verify the result.
+func Combine(shares [][]byte) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, ErrInvalidShares
+	}
+
+	size := len(shares[0])
+	if size < 2 {
+		return nil, ErrInvalidShares
+	}
+
+	xs := make([]byte, len(shares))
+	seen := make(map[byte]bool)
+
+	for i, share := range shares {
+		if len(share) != size {
+			return nil, ErrInvalidShares
+		}
+
+		x := share[size-1]
+		if x == 0 || seen[x] {
+			return nil, ErrInvalidShares
+		}
+
+		seen[x] = true
+		xs[i] = x
+	}
+
+	secret := make([]byte, size-1)
+	ys := make([]byte, len(shares))
+
+	for b := range secret {
+		for i, share := range shares {
+			ys[i] = share[b]
+		}
+
+		secret[b] = interpolateAtZero(xs, ys)
+	}
+
+	return secret, nil
+}
+
+// evaluate computes the polynomial with the given coefficients at x using
+// Horner's method.
+func evaluate(coefficients []byte, x byte) byte {
+	var result byte
+
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		result = add(mul(result, x), coefficients[i])
+	}
+
+	return result
+}
+
+// interpolateAtZero returns the value at x=0 of the polynomial passing through
+// the given points, using Lagrange interpolation.
+func interpolateAtZero(xs, ys []byte) byte {
+	var result byte
+
+	for i := range xs {
+		basis := byte(1)
+
+		for j := range xs {
+			if i == j {
+				continue
+			}
+
+			// (0 - x_j) / (x_i - x_j); subtraction is addition in GF(2^8).
+			basis = mul(basis, div(xs[j], add(xs[i], xs[j])))
+		}
+
+		result = add(result, mul(ys[i], basis))
+	}
+
+	return result
+}
+
+func add(a, b byte) byte {
+	return a ^ b
+}
+
+// mul multiplies in GF(2^8) modulo the AES polynomial x^8 + x^4 + x^3 + x + 1.
+func mul(a, b byte) byte {
+	var p byte
+
+	for i := 0; i < 8; i++ {
+		if b&1 == 1 {
+			p ^= a
+		}
+
+		carry := a & 0x80
+		a <<= 1
+		if carry != 0 {
+			a ^= 0x1b
+		}
+
+		b >>= 1
+	}
+
+	return p
+}
+
+// div divides in GF(2^8). b must not be zero.
+func div(a, b byte) byte {
+	return mul(a, inverse(b))
+}
+
+// inverse returns b^254, the multiplicative inverse of b in GF(2^8).
+func inverse(b byte) byte {
+	result := byte(1)
+
+	for i := 0; i < 254; i++ {
+		result = mul(result, b)
+	}
+
+	return result
+}
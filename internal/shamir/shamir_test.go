@@ -0,0 +1,118 @@
+package shamir
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+func TestSplitCombine(t *testing.T) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		t.Fatal(err)
+	}
+
+	shares, err := Split(secret, 5, 3)
+	if err != nil {
+		t.Fatalf("Split: %v", err)
+	}
+
+	if len(shares) != 5 {
+		t.Fatalf("got %d shares, want 5", len(shares))
+	}
+
+	// Every subset of at least the threshold recovers the secret.
+	for mask := 0; mask < 1<<len(shares); mask++ {
+		var subset [][]byte
+
+		for i := range shares {
+			if mask&(1<<i) != 0 {
+				subset = append(subset, shares[i])
+			}
+		}
+
+		if len(subset) < 3 {
+			continue
+		}
+
+		got, err := Combine(subset)
+		if err != nil {
+			t.Fatalf("Combine(%05b): %v", mask, err)
+		}
+
+		if !bytes.Equal(got, secret) {
+			t.Errorf("Combine(%05b) = %x, want %x", mask, got, secret)
+		}
+	}
+}
+
+func TestCombineBelowThreshold(t *testing.T) {
+	secret := []byte("correct horse battery staple")
+
+	shares, err := Split(secret, 5, 3)
+	if err != nil {
+		t.Fatalf("Split: %v", err)
+	}
+
+	got, err := Combine(shares[:2])
+	if err != nil {
+		t.Fatalf("Combine: %v", err)
+	}
+
+	if bytes.Equal(got, secret) {
+		t.Error("two shares of a 3-of-5 split recovered the secret")
+	}
+}
+
+func TestSplitInvalidParameters(t *testing.T) {
+	tests := []struct {
+		parts, threshold int
+	}{
+		{5, 1},
+		{2, 3},
+		{256, 3},
+	}
+
+	for _, tt := range tests {
+		_, err := Split([]byte("secret"), tt.parts, tt.threshold)
+		if err != ErrInvalidParameters {
+			t.Errorf("Split(parts=%d, threshold=%d): got %v, want ErrInvalidParameters", tt.parts, tt.threshold, err)
+		}
+	}
+
+	if _, err := Split(nil, 5, 3); err == nil {
+		t.Error("Split of an empty secret: got no error")
+	}
+}
+
+func TestCombineInvalidShares(t *testing.T) {
+	shares, err := Split([]byte("secret"), 3, 2)
+	if err != nil {
+		t.Fatalf("Split: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		shares [][]byte
+	}{
+		{"one share", shares[:1]},
+		{"different lengths", [][]byte{shares[0], shares[1][1:]}},
+		{"same x coordinate", [][]byte{shares[0], shares[0]}},
+		{"zero x coordinate", [][]byte{shares[0], {1, 2, 3, 4, 5, 6, 0}}},
+		{"too short", [][]byte{{1}, {2}}},
+	}
+
+	for _, tt := range tests {
+		if _, err := Combine(tt.shares); err != ErrInvalidShares {
+			t.Errorf("%s: got %v, want ErrInvalidShares", tt.name, err)
+		}
+	}
+}
+
+func TestFieldInverse(t *testing.T) {
+	for b := 1; b < 256; b++ {
+		if got := mul(byte(b), inverse(byte(b))); got != 1 {
+			t.Errorf("%#02x * inverse(%#02x) = %#02x, want 1", b, b, got)
+		}
+	}
+}
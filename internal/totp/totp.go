@@ -0,0 +1,195 @@
+// Package totp generates RFC 6238 time-based one-time passwords, including
+// the five character variant used by Steam.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidSecret    = errors.New("totp: secret must be base32 encoded")
+	ErrInvalidURI       = errors.New("totp: invalid otpauth URI")
+	ErrUnsupportedParam = errors.New("totp: unsupported algorithm, digits or period")
+)
+
+const (
+	DefaultDigits = 6
+	DefaultPeriod = 30
+
+	steamAlphabet = "23456789BCDFGHJKMNPQRTVWXY"
+	steamDigits   = 5
+)
+
+// Algorithm is the HMAC hash function codes are generated with.
+type Algorithm string
+
+const (
+	SHA1   Algorithm = "SHA1"
+	SHA256 Algorithm = "SHA256"
+	SHA512 Algorithm = "SHA512"
+)
+
+func (a Algorithm) hash() (func() hash.Hash, bool) {
+	switch a {
+	case SHA1:
+		return sha1.New, true
+	case SHA256:
+		return sha256.New, true
+	case SHA512:
+		return sha512.New, true
+	default:
+		return nil, false
+	}
+}
+
+// Key is a TOTP seed together with the parameters codes are generated with.
+type Key struct {
+	Secret    []byte
+	Algorithm Algorithm
+	Digits    int
+	Period    int
+	Steam     bool
+}
+
+// Parse reads a key from an otpauth://totp/ URI or a bare base32 seed. A
+// steam:// URI, or an otpauth URI with encoder=steam or issuer Steam, gives
+// a Steam key.
+func Parse(s string) (*Key, error) {
+	s = strings.TrimSpace(s)
+
+	switch {
+	case strings.HasPrefix(strings.ToLower(s), "otpauth://"):
+		return parseURI(s)
+	case strings.HasPrefix(strings.ToLower(s), "steam://"):
+		secret, err := decodeSecret(s[len("steam://"):])
+		if err != nil {
+			return nil, err
+		}
+
+		return &Key{Secret: secret, Algorithm: SHA1, Digits: steamDigits, Period: DefaultPeriod, Steam: true}, nil
+	default:
+		secret, err := decodeSecret(s)
+		if err != nil {
+			return nil, err
+		}
+
+		return &Key{Secret: secret, Algorithm: SHA1, Digits: DefaultDigits, Period: DefaultPeriod}, nil
+	}
+}
+
+func parseURI(s string) (*Key, error) {
+	u, err := url.Parse(s)
+	if err != nil || u.Host != "totp" {
+		return nil, ErrInvalidURI
+	}
+
+	q := u.Query()
+
+	secret, err := decodeSecret(q.Get("secret"))
+	if err != nil {
+		return nil, err
+	}
+
+	key := &Key{Secret: secret, Algorithm: SHA1, Digits: DefaultDigits, Period: DefaultPeriod}
+
+	if alg := q.Get("algorithm"); alg != "" {
+		key.Algorithm = Algorithm(strings.ToUpper(alg))
+	}
+
+	if digits := q.Get("digits"); digits != "" {
+		key.Digits, err = strconv.Atoi(digits)
+		if err != nil {
+			return nil, ErrInvalidURI
+		}
+	}
+
+	if period := q.Get("period"); period != "" {
+		key.Period, err = strconv.Atoi(period)
+		if err != nil {
+			return nil, ErrInvalidURI
+		}
+	}
+
+	if strings.EqualFold(q.Get("encoder"), "steam") || strings.EqualFold(q.Get("issuer"), "steam") {
+		key.Steam = true
+		key.Digits = steamDigits
+	}
+
+	if _, ok := key.Algorithm.hash(); !ok {
+		return nil, ErrUnsupportedParam
+	}
+
+	if !key.Steam && key.Digits != 6 && key.Digits != 7 && key.Digits != 8 {
+		return nil, ErrUnsupportedParam
+	}
+
+	if key.Period < 1 || key.Period > 300 {
+		return nil, ErrUnsupportedParam
+	}
+
+	return key, nil
+}
+
+// decodeSecret decodes a base32 seed, tolerating the lower case, spaces and
+// missing padding that authenticator apps commonly show.
+func decodeSecret(s string) ([]byte, error) {
+	s = strings.ToUpper(strings.ReplaceAll(s, " ", ""))
+	s = strings.TrimRight(s, "=")
+
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(s)
+	if err != nil || len(secret) == 0 {
+		return nil, ErrInvalidSecret
+	}
+
+	return secret, nil
+}
+
+// Code returns the code for time t.
+func (k *Key) Code(t time.Time) string {
+	newHash, _ := k.Algorithm.hash()
+
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(t.Unix())/uint64(k.Period))
+
+	mac := hmac.New(newHash, k.Secret)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation, RFC 4226 section 5.3.
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	if k.Steam {
+		code := make([]byte, steamDigits)
+		for i := range code {
+			code[i] = steamAlphabet[value%uint32(len(steamAlphabet))]
+			value /= uint32(len(steamAlphabet))
+		}
+
+		return string(code)
+	}
+
+	modulus := uint32(1)
+	for i := 0; i < k.Digits; i++ {
+		modulus *= 10
+	}
+
+	return fmt.Sprintf("%0*d", k.Digits, value%modulus)
+}
+
+// Remaining returns how many seconds the code for time t stays valid.
+func (k *Key) Remaining(t time.Time) int {
+	return k.Period - int(t.Unix()%int64(k.Period))
+}
@@ -0,0 +1,118 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCodeRFC6238 checks the test vectors of RFC 6238, Appendix B.
+func TestCodeRFC6238(t *testing.T) {
+	seeds := map[Algorithm]string{
+		SHA1:   "12345678901234567890",
+		SHA256: "12345678901234567890123456789012",
+		SHA512: "1234567890123456789012345678901234567890123456789012345678901234",
+	}
+
+	tests := []struct {
+		time int64
+		want map[Algorithm]string
+	}{
+		{59, map[Algorithm]string{SHA1: "94287082", SHA256: "46119246", SHA512: "90693936"}},
+		{1111111109, map[Algorithm]string{SHA1: "07081804", SHA256: "68084774", SHA512: "25091201"}},
+		{1111111111, map[Algorithm]string{SHA1: "14050471", SHA256: "67062674", SHA512: "99943326"}},
+		{1234567890, map[Algorithm]string{SHA1: "89005924", SHA256: "91819424", SHA512: "93441116"}},
+		{2000000000, map[Algorithm]string{SHA1: "69279037", SHA256: "90698825", SHA512: "38618901"}},
+		{20000000000, map[Algorithm]string{SHA1: "65353130", SHA256: "77737706", SHA512: "47863826"}},
+	}
+
+	for _, tt := range tests {
+		for alg, want := range tt.want {
+			key := &Key{Secret: []byte(seeds[alg]), Algorithm: alg, Digits: 8, Period: DefaultPeriod}
+
+			if got := key.Code(time.Unix(tt.time, 0)); got != want {
+				t.Errorf("%s at %d: got %s, want %s", alg, tt.time, got, want)
+			}
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Key
+		err   error
+	}{
+		{
+			input: "gezd gnbv gy3t qojq",
+			want:  Key{Algorithm: SHA1, Digits: 6, Period: 30},
+		},
+		{
+			input: "otpauth://totp/Example:alice@example.com?secret=GEZDGNBVGY3TQOJQ&algorithm=sha256&digits=8&period=60",
+			want:  Key{Algorithm: SHA256, Digits: 8, Period: 60},
+		},
+		{
+			input: "otpauth://totp/Steam:alice?secret=GEZDGNBVGY3TQOJQ&issuer=Steam",
+			want:  Key{Algorithm: SHA1, Digits: 5, Period: 30, Steam: true},
+		},
+		{
+			input: "steam://GEZDGNBVGY3TQOJQ",
+			want:  Key{Algorithm: SHA1, Digits: 5, Period: 30, Steam: true},
+		},
+		{input: "not base32!", err: ErrInvalidSecret},
+		{input: "otpauth://hotp/x?secret=GEZDGNBVGY3TQOJQ", err: ErrInvalidURI},
+		{input: "otpauth://totp/x?secret=GEZDGNBVGY3TQOJQ&algorithm=MD5", err: ErrUnsupportedParam},
+		{input: "otpauth://totp/x?secret=GEZDGNBVGY3TQOJQ&digits=9", err: ErrUnsupportedParam},
+		{input: "otpauth://totp/x?secret=GEZDGNBVGY3TQOJQ&period=0", err: ErrUnsupportedParam},
+	}
+
+	for _, tt := range tests {
+		key, err := Parse(tt.input)
+		if err != tt.err {
+			t.Errorf("Parse(%q): got error %v, want %v", tt.input, err, tt.err)
+			continue
+		}
+
+		if err != nil {
+			continue
+		}
+
+		if string(key.Secret) != "1234567890" {
+			t.Errorf("Parse(%q): got secret %q, want %q", tt.input, key.Secret, "1234567890")
+		}
+
+		if key.Algorithm != tt.want.Algorithm || key.Digits != tt.want.Digits || key.Period != tt.want.Period || key.Steam != tt.want.Steam {
+			t.Errorf("Parse(%q): got %+v, want %+v", tt.input, *key, tt.want)
+		}
+	}
+}
+
+func TestSteamCode(t *testing.T) {
+	key, err := Parse("steam://GEZDGNBVGY3TQOJQ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code := key.Code(time.Unix(1234567890, 0))
+	if len(code) != 5 {
+		t.Fatalf("got code %q, want 5 characters", code)
+	}
+
+	for _, c := range code {
+		if !strings.ContainsRune(steamAlphabet, c) {
+			t.Errorf("code %q has %q, which is not in the Steam alphabet", code, c)
+		}
+	}
+}
+
+func TestRemaining(t *testing.T) {
+	key := &Key{Period: 30}
+
+	tests := map[int64]int{0: 30, 1: 29, 29: 1, 30: 30, 59: 1}
+
+	for unix, want := range tests {
+		if got := key.Remaining(time.Unix(unix, 0)); got != want {
+			t.Errorf("Remaining at %d: got %d, want %d", unix, got, want)
+		}
+	}
+}
@@ -0,0 +1 @@
+ALTER TABLE logins DROP COLUMN encrypted;
\ No newline at end of file
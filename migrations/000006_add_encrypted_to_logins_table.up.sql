@@ -0,0 +1 @@
+ALTER TABLE logins ADD encrypted boolean NOT NULL DEFAULT false;
\ No newline at end of file
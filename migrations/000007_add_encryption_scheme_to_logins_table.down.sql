@@ -0,0 +1,10 @@
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM logins WHERE encryption_scheme >= 2) THEN
+        RAISE EXCEPTION 'cannot roll back: some logins use envelope encryption (encryption_scheme >= 2), which the encrypted column cannot represent';
+    END IF;
+END
+$$;
+ALTER TABLE logins ADD encrypted boolean NOT NULL DEFAULT false;
+UPDATE logins SET encrypted = true WHERE encryption_scheme = 1;
+ALTER TABLE logins DROP COLUMN encryption_scheme;
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE logins ADD encryption_scheme smallint NOT NULL DEFAULT 0;
+UPDATE logins SET encryption_scheme = 1 WHERE encrypted;
+ALTER TABLE logins DROP COLUMN encrypted;
\ No newline at end of file
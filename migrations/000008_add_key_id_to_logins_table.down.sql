@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS logins_key_id_idx;
+ALTER TABLE logins DROP COLUMN key_id;
\ No newline at end of file
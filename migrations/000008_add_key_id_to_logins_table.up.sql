@@ -0,0 +1,2 @@
+ALTER TABLE logins ADD key_id text;
+CREATE INDEX IF NOT EXISTS logins_key_id_idx ON logins (key_id);
\ No newline at end of file
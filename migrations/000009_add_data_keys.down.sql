@@ -0,0 +1,3 @@
+ALTER TABLE tokens DROP COLUMN data_key;
+ALTER TABLE users DROP COLUMN data_key_salt;
+ALTER TABLE users DROP COLUMN data_key;
\ No newline at end of file
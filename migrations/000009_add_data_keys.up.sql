@@ -0,0 +1,6 @@
+ALTER TABLE users ADD data_key bytea;
+ALTER TABLE users ADD data_key_salt bytea;
+ALTER TABLE tokens ADD data_key bytea;
+
+-- Existing sessions don't carry a data key; users have to log in again.
+DELETE FROM tokens WHERE scope = 'authentication';
\ No newline at end of file
@@ -0,0 +1,4 @@
+ALTER TABLE logins DROP CONSTRAINT IF EXISTS logins_mode_check;
+ALTER TABLE logins DROP COLUMN revision;
+ALTER TABLE logins DROP COLUMN sealed_item;
+ALTER TABLE logins DROP COLUMN mode;
\ No newline at end of file
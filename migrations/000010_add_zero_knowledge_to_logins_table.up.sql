@@ -0,0 +1,4 @@
+ALTER TABLE logins ADD mode text NOT NULL DEFAULT 'standard';
+ALTER TABLE logins ADD sealed_item jsonb;
+ALTER TABLE logins ADD revision integer NOT NULL DEFAULT 0;
+ALTER TABLE logins ADD CONSTRAINT logins_mode_check CHECK (mode IN ('standard', 'zero_knowledge'));
\ No newline at end of file
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS logins_user_id_idx ON logins (user_id);
\ No newline at end of file
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS logins_search_vector_idx;
+DROP TRIGGER IF EXISTS logins_search_vector_trigger ON logins;
+DROP FUNCTION IF EXISTS logins_search_vector_update();
+ALTER TABLE logins DROP COLUMN search_vector;
+ALTER TABLE logins DROP COLUMN notes;
\ No newline at end of file
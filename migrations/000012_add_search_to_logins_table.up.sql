@@ -0,0 +1,21 @@
+ALTER TABLE logins ADD notes text NOT NULL DEFAULT '';
+ALTER TABLE logins ADD search_vector tsvector;
+
+CREATE OR REPLACE FUNCTION logins_search_vector_update() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector :=
+        setweight(to_tsvector('simple', coalesce(NEW.name, '')), 'A') ||
+        setweight(to_tsvector('simple', coalesce(NEW.username, '')), 'B') ||
+        setweight(to_tsvector('simple', coalesce(NEW.website, '')), 'C') ||
+        setweight(to_tsvector('simple', coalesce(NEW.notes, '')), 'D');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER logins_search_vector_trigger
+    BEFORE INSERT OR UPDATE OF name, username, website, notes ON logins
+    FOR EACH ROW EXECUTE FUNCTION logins_search_vector_update();
+
+UPDATE logins SET name = name;
+
+CREATE INDEX IF NOT EXISTS logins_search_vector_idx ON logins USING GIN (search_vector);
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS login_revisions;
\ No newline at end of file
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS login_revisions (
+    login_id bigint NOT NULL REFERENCES logins ON DELETE CASCADE,
+    version integer NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text NOT NULL,
+    username text NOT NULL,
+    password bytea NOT NULL,
+    encryption_scheme smallint NOT NULL,
+    key_id text,
+    website text,
+    notes text NOT NULL,
+    sealed_item jsonb,
+    revision integer NOT NULL,
+    PRIMARY KEY (login_id, version)
+);
+
+CREATE INDEX IF NOT EXISTS login_revisions_key_id_idx ON login_revisions (key_id);
\ No newline at end of file
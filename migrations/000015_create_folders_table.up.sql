@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS folders (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    parent_id bigint REFERENCES folders ON DELETE CASCADE,
+    name text NOT NULL,
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS folders_user_id_parent_id_name_idx ON folders (user_id, COALESCE(parent_id, 0), name);
+CREATE INDEX IF NOT EXISTS folders_parent_id_idx ON folders (parent_id);
+
+ALTER TABLE logins ADD COLUMN IF NOT EXISTS folder_id bigint REFERENCES folders ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS logins_folder_id_idx ON logins (folder_id);
\ No newline at end of file
@@ -0,0 +1,18 @@
+DROP TRIGGER IF EXISTS logins_tags_search_vector_trigger ON logins_tags;
+DROP FUNCTION IF EXISTS logins_tags_search_vector_update();
+
+CREATE OR REPLACE FUNCTION logins_search_vector_update() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector :=
+        setweight(to_tsvector('simple', coalesce(NEW.name, '')), 'A') ||
+        setweight(to_tsvector('simple', coalesce(NEW.username, '')), 'B') ||
+        setweight(to_tsvector('simple', coalesce(NEW.website, '')), 'C') ||
+        setweight(to_tsvector('simple', coalesce(NEW.notes, '')), 'D');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TABLE IF EXISTS logins_tags;
+DROP TABLE IF EXISTS tags;
+
+UPDATE logins SET name = name;
\ No newline at end of file
@@ -0,0 +1,48 @@
+CREATE TABLE IF NOT EXISTS tags (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    name text NOT NULL,
+    UNIQUE (user_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS logins_tags (
+    login_id bigint NOT NULL REFERENCES logins ON DELETE CASCADE,
+    tag_id bigint NOT NULL REFERENCES tags ON DELETE CASCADE,
+    PRIMARY KEY (login_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS logins_tags_tag_id_idx ON logins_tags (tag_id);
+
+CREATE OR REPLACE FUNCTION logins_search_vector_update() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector :=
+        setweight(to_tsvector('simple', coalesce(NEW.name, '')), 'A') ||
+        setweight(to_tsvector('simple', coalesce(NEW.username, '')), 'B') ||
+        setweight(to_tsvector('simple', coalesce((
+            SELECT string_agg(tags.name, ' ')
+            FROM logins_tags
+            INNER JOIN tags ON tags.id = logins_tags.tag_id
+            WHERE logins_tags.login_id = NEW.id
+        ), '')), 'B') ||
+        setweight(to_tsvector('simple', coalesce(NEW.website, '')), 'C') ||
+        setweight(to_tsvector('simple', coalesce(NEW.notes, '')), 'D');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+-- Tags live in their own table, so changing them refreshes the login's
+-- search vector by touching the login row.
+CREATE OR REPLACE FUNCTION logins_tags_search_vector_update() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        UPDATE logins SET name = name WHERE id = OLD.login_id;
+    ELSE
+        UPDATE logins SET name = name WHERE id = NEW.login_id;
+    END IF;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER logins_tags_search_vector_trigger
+    AFTER INSERT OR DELETE ON logins_tags
+    FOR EACH ROW EXECUTE FUNCTION logins_tags_search_vector_update();
\ No newline at end of file
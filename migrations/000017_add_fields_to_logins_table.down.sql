@@ -0,0 +1,2 @@
+ALTER TABLE login_revisions DROP COLUMN IF EXISTS fields;
+ALTER TABLE logins DROP COLUMN IF EXISTS fields;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE logins ADD fields jsonb NOT NULL DEFAULT '[]';
+ALTER TABLE login_revisions ADD fields jsonb NOT NULL DEFAULT '[]';
\ No newline at end of file
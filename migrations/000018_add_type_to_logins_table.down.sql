@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS logins_user_id_type_idx;
+
+ALTER TABLE login_revisions DROP COLUMN IF EXISTS content;
+
+ALTER TABLE logins DROP CONSTRAINT IF EXISTS logins_type_check;
+ALTER TABLE logins DROP COLUMN IF EXISTS content;
+ALTER TABLE logins DROP COLUMN IF EXISTS type;
\ No newline at end of file
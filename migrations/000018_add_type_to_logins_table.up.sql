@@ -0,0 +1,7 @@
+ALTER TABLE logins ADD type text NOT NULL DEFAULT 'login';
+ALTER TABLE logins ADD content bytea;
+ALTER TABLE logins ADD CONSTRAINT logins_type_check CHECK (type IN ('login', 'secure_note', 'card', 'identity', 'ssh_key', 'api_key'));
+
+ALTER TABLE login_revisions ADD content bytea;
+
+CREATE INDEX IF NOT EXISTS logins_user_id_type_idx ON logins (user_id, type);
\ No newline at end of file
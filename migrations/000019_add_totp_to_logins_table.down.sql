@@ -0,0 +1,2 @@
+ALTER TABLE login_revisions DROP COLUMN IF EXISTS totp;
+ALTER TABLE logins DROP COLUMN IF EXISTS totp;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE logins ADD totp bytea;
+ALTER TABLE login_revisions ADD totp bytea;
\ No newline at end of file
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS attachments (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    login_id bigint NOT NULL REFERENCES logins ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    name text NOT NULL,
+    content_type text NOT NULL,
+    size bigint NOT NULL,
+    blob_key text NOT NULL UNIQUE,
+    file_key bytea NOT NULL,
+    key_id text NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS attachments_login_id_idx ON attachments (login_id);
+CREATE INDEX IF NOT EXISTS attachments_user_id_idx ON attachments (user_id);
\ No newline at end of file
@@ -0,0 +1,27 @@
+CREATE OR REPLACE FUNCTION logins_search_vector_update() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector :=
+        setweight(to_tsvector('simple', coalesce(NEW.name, '')), 'A') ||
+        setweight(to_tsvector('simple', coalesce(NEW.username, '')), 'B') ||
+        setweight(to_tsvector('simple', coalesce((
+            SELECT string_agg(tags.name, ' ')
+            FROM logins_tags
+            INNER JOIN tags ON tags.id = logins_tags.tag_id
+            WHERE logins_tags.login_id = NEW.id
+        ), '')), 'B') ||
+        setweight(to_tsvector('simple', coalesce(NEW.website, '')), 'C') ||
+        setweight(to_tsvector('simple', coalesce(NEW.notes, '')), 'D');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS logins_search_vector_trigger ON logins;
+
+CREATE TRIGGER logins_search_vector_trigger
+    BEFORE INSERT OR UPDATE OF name, username, website, notes ON logins
+    FOR EACH ROW EXECUTE FUNCTION logins_search_vector_update();
+
+ALTER TABLE login_revisions DROP COLUMN IF EXISTS uris;
+ALTER TABLE logins DROP COLUMN IF EXISTS uris;
+
+UPDATE logins SET name = name;
\ No newline at end of file
@@ -0,0 +1,40 @@
+ALTER TABLE logins ADD uris jsonb NOT NULL DEFAULT '[]';
+ALTER TABLE login_revisions ADD uris jsonb NOT NULL DEFAULT '[]';
+
+-- Existing websites become the single URI of their login. The website column
+-- stays, holding the primary URI, so logins can still be sorted by it.
+UPDATE logins
+SET uris = jsonb_build_array(jsonb_build_object('uri', website, 'match', 'base_domain'))
+WHERE website IS NOT NULL AND website <> '';
+
+UPDATE login_revisions
+SET uris = jsonb_build_array(jsonb_build_object('uri', website, 'match', 'base_domain'))
+WHERE website IS NOT NULL AND website <> '';
+
+CREATE OR REPLACE FUNCTION logins_search_vector_update() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector :=
+        setweight(to_tsvector('simple', coalesce(NEW.name, '')), 'A') ||
+        setweight(to_tsvector('simple', coalesce(NEW.username, '')), 'B') ||
+        setweight(to_tsvector('simple', coalesce((
+            SELECT string_agg(tags.name, ' ')
+            FROM logins_tags
+            INNER JOIN tags ON tags.id = logins_tags.tag_id
+            WHERE logins_tags.login_id = NEW.id
+        ), '')), 'B') ||
+        setweight(to_tsvector('simple', coalesce((
+            SELECT string_agg(uri->>'uri', ' ')
+            FROM jsonb_array_elements(NEW.uris) AS uri
+        ), '')), 'C') ||
+        setweight(to_tsvector('simple', coalesce(NEW.notes, '')), 'D');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS logins_search_vector_trigger ON logins;
+
+CREATE TRIGGER logins_search_vector_trigger
+    BEFORE INSERT OR UPDATE OF name, username, website, uris, notes ON logins
+    FOR EACH ROW EXECUTE FUNCTION logins_search_vector_update();
+
+UPDATE logins SET name = name;
\ No newline at end of file
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS logins_favorite_idx;
+
+ALTER TABLE logins DROP COLUMN IF EXISTS use_count;
+ALTER TABLE logins DROP COLUMN IF EXISTS last_used_at;
+ALTER TABLE logins DROP COLUMN IF EXISTS favorite;
\ No newline at end of file
@@ -0,0 +1,5 @@
+ALTER TABLE logins ADD favorite boolean NOT NULL DEFAULT false;
+ALTER TABLE logins ADD last_used_at timestamp(0) with time zone;
+ALTER TABLE logins ADD use_count integer NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS logins_favorite_idx ON logins (user_id) WHERE favorite;
\ No newline at end of file
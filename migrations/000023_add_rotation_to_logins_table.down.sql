@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS logins_rotation_idx;
+
+ALTER TABLE logins DROP COLUMN IF EXISTS password_changed_at;
+ALTER TABLE logins DROP COLUMN IF EXISTS rotation_notified_at;
+ALTER TABLE logins DROP COLUMN IF EXISTS rotation_expires_at;
+ALTER TABLE logins DROP COLUMN IF EXISTS rotation_interval_days;
\ No newline at end of file
@@ -0,0 +1,11 @@
+ALTER TABLE logins ADD rotation_interval_days integer;
+ALTER TABLE logins ADD rotation_expires_at timestamp(0) with time zone;
+ALTER TABLE logins ADD rotation_notified_at timestamp(0) with time zone;
+ALTER TABLE logins ADD password_changed_at timestamp(0) with time zone NOT NULL DEFAULT NOW();
+
+-- When existing passwords were last changed isn't known, so they are taken to
+-- be as old as their login.
+UPDATE logins SET password_changed_at = created_at;
+
+CREATE INDEX IF NOT EXISTS logins_rotation_idx ON logins (user_id)
+WHERE rotation_interval_days IS NOT NULL OR rotation_expires_at IS NOT NULL;
\ No newline at end of file
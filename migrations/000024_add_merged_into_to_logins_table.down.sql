@@ -0,0 +1 @@
+ALTER TABLE logins DROP COLUMN IF EXISTS merged_into_id;
\ No newline at end of file
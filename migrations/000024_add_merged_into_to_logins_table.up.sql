@@ -0,0 +1 @@
+ALTER TABLE logins ADD merged_into_id bigint REFERENCES logins ON DELETE SET NULL;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE logins DROP COLUMN IF EXISTS rotation_retry_at;
+ALTER TABLE logins DROP COLUMN IF EXISTS rotation_notify_attempts;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE logins ADD rotation_notify_attempts integer NOT NULL DEFAULT 0;
+ALTER TABLE logins ADD rotation_retry_at timestamp(0) with time zone;
\ No newline at end of file
@@ -0,0 +1,32 @@
+ALTER TABLE logins ADD sealed_notes bytea;
+ALTER TABLE login_revisions ADD sealed_notes bytea;
+
+-- Notes are sealed like the other secret fields from now on, so they can no
+-- longer be searched. Plaintext notes written before this stay in the notes
+-- column until they are sealed, but are dropped from the search vector now.
+CREATE OR REPLACE FUNCTION logins_search_vector_update() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector :=
+        setweight(to_tsvector('simple', coalesce(NEW.name, '')), 'A') ||
+        setweight(to_tsvector('simple', coalesce(NEW.username, '')), 'B') ||
+        setweight(to_tsvector('simple', coalesce((
+            SELECT string_agg(tags.name, ' ')
+            FROM logins_tags
+            INNER JOIN tags ON tags.id = logins_tags.tag_id
+            WHERE logins_tags.login_id = NEW.id
+        ), '')), 'B') ||
+        setweight(to_tsvector('simple', coalesce((
+            SELECT string_agg(uri->>'uri', ' ')
+            FROM jsonb_array_elements(NEW.uris) AS uri
+        ), '')), 'C');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS logins_search_vector_trigger ON logins;
+
+CREATE TRIGGER logins_search_vector_trigger
+    BEFORE INSERT OR UPDATE OF name, username, website, uris ON logins
+    FOR EACH ROW EXECUTE FUNCTION logins_search_vector_update();
+
+UPDATE logins SET name = name;
\ No newline at end of file
@@ -0,0 +1,13 @@
+UPDATE logins
+SET fields = (
+    SELECT jsonb_agg(f.field - 'id' ORDER BY f.n)
+    FROM jsonb_array_elements(fields) WITH ORDINALITY AS f(field, n)
+)
+WHERE fields <> '[]';
+
+UPDATE login_revisions
+SET fields = (
+    SELECT jsonb_agg(f.field - 'id' ORDER BY f.n)
+    FROM jsonb_array_elements(fields) WITH ORDINALITY AS f(field, n)
+)
+WHERE fields <> '[]';
\ No newline at end of file
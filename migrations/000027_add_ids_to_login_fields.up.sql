@@ -0,0 +1,15 @@
+-- Give every stored custom field an ID, so a masked hidden field can be
+-- matched to its value by ID rather than by name.
+UPDATE logins
+SET fields = (
+    SELECT jsonb_agg(f.field || jsonb_build_object('id', substr(md5(random()::text), 1, 16)) ORDER BY f.n)
+    FROM jsonb_array_elements(fields) WITH ORDINALITY AS f(field, n)
+)
+WHERE fields <> '[]';
+
+UPDATE login_revisions
+SET fields = (
+    SELECT jsonb_agg(f.field || jsonb_build_object('id', substr(md5(random()::text), 1, 16)) ORDER BY f.n)
+    FROM jsonb_array_elements(fields) WITH ORDINALITY AS f(field, n)
+)
+WHERE fields <> '[]';
\ No newline at end of file
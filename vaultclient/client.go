@@ -0,0 +1,216 @@
+package vaultclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Client talks to the passman API, sealing items before they are sent and
+// opening them once they come back.
+type Client struct {
+	BaseURL    string
+	Token      string
+	Key        *Key
+	HTTPClient *http.Client
+}
+
+// Login is a decrypted zero-knowledge login. ItemID is the ID its item is
+// sealed under; keep it with the login ID to detect a swapped item in Reload.
+// It is empty for items sealed before item IDs were introduced.
+type Login struct {
+	ID       int64
+	ItemID   string
+	Revision int32
+	Version  int32
+	Item     *Item
+}
+
+// APIError is returned when the API responds with an error status.
+type APIError struct {
+	StatusCode int
+	Message    interface{}
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("vaultclient: api returned %d: %v", e.StatusCode, e.Message)
+}
+
+type apiLogin struct {
+	ID       int64       `json:"id"`
+	Mode     string      `json:"mode"`
+	Item     *SealedItem `json:"item"`
+	Revision int32       `json:"revision"`
+	Version  int32       `json:"version"`
+}
+
+// Create seals item and stores it as a new login.
+func (c *Client) Create(ctx context.Context, item *Item) (*Login, error) {
+	itemID, err := NewItemID()
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := Seal(c.Key, itemID, item)
+	if err != nil {
+		return nil, err
+	}
+
+	body := map[string]interface{}{
+		"mode":     "zero_knowledge",
+		"item":     sealed,
+		"revision": 1,
+	}
+
+	var resp struct {
+		Login apiLogin `json:"login"`
+	}
+
+	err = c.do(ctx, http.MethodPost, "/v1/logins", body, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Login{ID: resp.Login.ID, ItemID: itemID, Revision: resp.Login.Revision, Version: resp.Login.Version, Item: item}, nil
+}
+
+// Get fetches and opens a login. It accepts any item sealed with the client's
+// key; use Reload for a login whose item ID is already known.
+func (c *Client) Get(ctx context.Context, id int64) (*Login, error) {
+	return c.get(ctx, id, "")
+}
+
+// Reload fetches the login again and replaces its item, revision and version.
+// It fails with ErrWrongItem if the server returns an item other than the one
+// the login was sealed under.
+func (c *Client) Reload(ctx context.Context, login *Login) error {
+	fetched, err := c.get(ctx, login.ID, login.ItemID)
+	if err != nil {
+		return err
+	}
+
+	*login = *fetched
+
+	return nil
+}
+
+func (c *Client) get(ctx context.Context, id int64, itemID string) (*Login, error) {
+	var resp struct {
+		Login apiLogin `json:"login"`
+	}
+
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/v1/logins/%d", id), nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Login.Mode != "zero_knowledge" || resp.Login.Item == nil {
+		return nil, fmt.Errorf("vaultclient: login %d is not a zero-knowledge login", id)
+	}
+
+	item, err := Open(c.Key, itemID, resp.Login.Item)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Login{ID: resp.Login.ID, ItemID: resp.Login.Item.ItemID, Revision: resp.Login.Revision, Version: resp.Login.Version, Item: item}, nil
+}
+
+// Update reseals the login's item and stores it under the next revision. The
+// login's revision and version are updated on success. A legacy item is given
+// an item ID the first time it is updated.
+func (c *Client) Update(ctx context.Context, login *Login) error {
+	itemID := login.ItemID
+
+	if itemID == "" {
+		var err error
+
+		itemID, err = NewItemID()
+		if err != nil {
+			return err
+		}
+	}
+
+	sealed, err := Seal(c.Key, itemID, login.Item)
+	if err != nil {
+		return err
+	}
+
+	body := map[string]interface{}{
+		"item":     sealed,
+		"revision": login.Revision + 1,
+	}
+
+	var resp struct {
+		Login apiLogin `json:"login"`
+	}
+
+	err = c.do(ctx, http.MethodPatch, fmt.Sprintf("/v1/logins/%d", login.ID), body, &resp)
+	if err != nil {
+		return err
+	}
+
+	login.ItemID = itemID
+	login.Revision = resp.Login.Revision
+	login.Version = resp.Login.Version
+
+	return nil
+}
+
+// Delete removes a login.
+func (c *Client) Delete(ctx context.Context, id int64) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/v1/logins/%d", id), nil, nil)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, dst interface{}) error {
+	var reader io.Reader
+
+	if body != nil {
+		js, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(js)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(c.BaseURL, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		var apiErr struct {
+			Error interface{} `json:"error"`
+		}
+
+		json.NewDecoder(res.Body).Decode(&apiErr)
+
+		return &APIError{StatusCode: res.StatusCode, Message: apiErr.Error}
+	}
+
+	if dst == nil {
+		return nil
+	}
+
+	return json.NewDecoder(res.Body).Decode(dst)
+}
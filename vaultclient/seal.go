@@ -0,0 +1,205 @@
+// Package vaultclient is a reference client for zero-knowledge logins. Items
+// are sealed on the client with a key the server never sees, and only the
+// resulting envelope is sent to the passman API.
+//
+// Every sealed item carries a random item ID that is bound to its ciphertext.
+// A client that remembers the item ID of each login can tell when the server
+// returns a different item than the one it stored.
+package vaultclient
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	// KeySize is the length in bytes of a vault key.
+	KeySize = 32
+
+	sealedItemVersion = 2
+	algorithmA256GCM  = "A256GCM"
+
+	// Items sealed before item IDs were introduced. They can still be opened
+	// but are never written.
+	legacySealedItemVersion = 1
+)
+
+var (
+	ErrInvalidKey  = errors.New("vaultclient: key must be 32 bytes long")
+	ErrWrongKey    = errors.New("vaultclient: item was sealed with a different key")
+	ErrUnsupported = errors.New("vaultclient: unsupported item version or algorithm")
+	ErrTampered    = errors.New("vaultclient: item failed authentication")
+	ErrWrongItem   = errors.New("vaultclient: item is not the one that was requested")
+)
+
+// Item is the plaintext content of a zero-knowledge login.
+type Item struct {
+	Name     string `json:"name"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Website  string `json:"website,omitempty"`
+	Notes    string `json:"notes,omitempty"`
+}
+
+// SealedItem is the envelope stored by the server. It mirrors the item field
+// of a zero-knowledge login in the API.
+type SealedItem struct {
+	Version    int    `json:"version"`
+	Algorithm  string `json:"algorithm"`
+	KeyID      string `json:"key_id"`
+	ItemID     string `json:"item_id,omitempty"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// Key is a vault key together with the ID recorded in the items it seals.
+type Key struct {
+	ID       string
+	Material []byte
+}
+
+// Argon2id parameters used by DeriveKey.
+const (
+	argon2Time    = 3
+	argon2Memory  = 64 * 1024
+	argon2Threads = 4
+)
+
+// DeriveKey derives a vault key from a passphrase with Argon2id. The salt
+// should be random, at least 16 bytes, and stored by the client alongside the
+// key ID.
+func DeriveKey(id string, passphrase, salt []byte) (*Key, error) {
+	if len(salt) < 16 {
+		return nil, errors.New("vaultclient: salt must be at least 16 bytes long")
+	}
+
+	material := argon2.IDKey(passphrase, salt, argon2Time, argon2Memory, argon2Threads, KeySize)
+
+	return &Key{ID: id, Material: material}, nil
+}
+
+// NewItemID returns a random item ID for a login that is about to be created.
+func NewItemID() (string, error) {
+	b := make([]byte, 16)
+
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// additionalData binds the envelope header, including the item ID, to the
+// ciphertext.
+func additionalData(s *SealedItem) []byte {
+	if s.Version == legacySealedItemVersion {
+		return []byte(fmt.Sprintf("passman-item:%d:%s:%s", s.Version, s.Algorithm, s.KeyID))
+	}
+
+	return []byte(fmt.Sprintf("passman-item:%d:%s:%s:%s", s.Version, s.Algorithm, s.KeyID, s.ItemID))
+}
+
+// Seal encrypts item with the key under the given item ID. A login keeps its
+// item ID for as long as it exists.
+func Seal(key *Key, itemID string, item *Item) (*SealedItem, error) {
+	if itemID == "" {
+		return nil, errors.New("vaultclient: item ID must be provided")
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := json.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := &SealedItem{
+		Version:   sealedItemVersion,
+		Algorithm: algorithmA256GCM,
+		KeyID:     key.ID,
+		ItemID:    itemID,
+		Nonce:     make([]byte, aead.NonceSize()),
+	}
+
+	if _, err := io.ReadFull(rand.Reader, sealed.Nonce); err != nil {
+		return nil, err
+	}
+
+	sealed.Ciphertext = aead.Seal(nil, sealed.Nonce, plaintext, additionalData(sealed))
+
+	return sealed, nil
+}
+
+// Open decrypts an item sealed with Seal. If itemID isn't empty, the item must
+// have been sealed under that ID; legacy items without one are rejected then.
+func Open(key *Key, itemID string, sealed *SealedItem) (*Item, error) {
+	switch {
+	case sealed.Algorithm != algorithmA256GCM:
+		return nil, ErrUnsupported
+	case sealed.Version == sealedItemVersion:
+		if sealed.ItemID == "" {
+			return nil, ErrTampered
+		}
+	case sealed.Version == legacySealedItemVersion:
+		if sealed.ItemID != "" {
+			return nil, ErrTampered
+		}
+	default:
+		return nil, ErrUnsupported
+	}
+
+	if itemID != "" && sealed.ItemID != itemID {
+		return nil, ErrWrongItem
+	}
+
+	if sealed.KeyID != key.ID {
+		return nil, ErrWrongKey
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed.Nonce) != aead.NonceSize() {
+		return nil, ErrTampered
+	}
+
+	plaintext, err := aead.Open(nil, sealed.Nonce, sealed.Ciphertext, additionalData(sealed))
+	if err != nil {
+		return nil, ErrTampered
+	}
+
+	var item Item
+
+	err = json.Unmarshal(plaintext, &item)
+	if err != nil {
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+func newAEAD(key *Key) (cipher.AEAD, error) {
+	if len(key.Material) != KeySize {
+		return nil, ErrInvalidKey
+	}
+
+	block, err := aes.NewCipher(key.Material)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,55 @@
+package vaultclient
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSealOpen(t *testing.T) {
+	key := &Key{ID: "k1", Material: bytes.Repeat([]byte{0x42}, KeySize)}
+	item := &Item{Name: "Example", Username: "alice", Password: "hunter22"}
+
+	sealed, err := Seal(key, "item-a", item)
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+
+	for _, itemID := range []string{"", "item-a"} {
+		got, err := Open(key, itemID, sealed)
+		if err != nil {
+			t.Fatalf("Open(%q): %v", itemID, err)
+		}
+
+		if *got != *item {
+			t.Errorf("Open(%q) = %+v, want %+v", itemID, *got, *item)
+		}
+	}
+}
+
+func TestOpenSwappedItem(t *testing.T) {
+	key := &Key{ID: "k1", Material: bytes.Repeat([]byte{0x42}, KeySize)}
+
+	sealed, err := Seal(key, "item-b", &Item{Name: "Other"})
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+
+	if _, err := Open(key, "item-a", sealed); err != ErrWrongItem {
+		t.Errorf("Open of another login's item: got %v, want ErrWrongItem", err)
+	}
+
+	// Relabelling the item doesn't help, since the ID is authenticated.
+	sealed.ItemID = "item-a"
+
+	if _, err := Open(key, "item-a", sealed); err != ErrTampered {
+		t.Errorf("Open of a relabelled item: got %v, want ErrTampered", err)
+	}
+
+	// Nor does passing it off as a legacy item without an ID.
+	sealed.Version = legacySealedItemVersion
+	sealed.ItemID = ""
+
+	if _, err := Open(key, "", sealed); err != ErrTampered {
+		t.Errorf("Open of a downgraded item: got %v, want ErrTampered", err)
+	}
+}